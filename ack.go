@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// MessageIDHeader is the metadata header identifying an acknowledged action.
+const MessageIDHeader = "message-id"
+
+// ackDedupSize is the number of message ids remembered per identifier by
+// OnNamedActionAcked.
+const ackDedupSize = 1024
+
+var ErrNotAcknowledged = errors.New("action not acknowledged")
+
+// AckOptions configures SendActionAcked, zero values get defaults.
+type AckOptions struct {
+	// Timeout applies when ctx has no deadline, 10s by default.
+	Timeout time.Duration
+	// The action is sent again after InitialBackoff (200ms), the delay
+	// doubling up to MaxBackoff (5s).
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// AckIdentifier is the identifier of the event acknowledging the actions
+// of identifier.
+func AckIdentifier(identifier string) string {
+	return identifier + "_ack"
+}
+
+func newMessageID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// SendActionAcked sends an action until the receiving module, which
+// handles it with OnNamedActionAcked, acknowledges it. It returns
+// ErrNotAcknowledged, or the error of ctx, when no ack came in time.
+func (c *Client) SendActionAcked(ctx context.Context, identifier string, data rotonde.Object, options AckOptions) error {
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	if options.InitialBackoff <= 0 {
+		options.InitialBackoff = 200 * time.Millisecond
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = 5 * time.Second
+	}
+	if _, ok := ctx.Deadline(); ok == false {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	messageID := newMessageID()
+	acked := c.expectAck(identifier, messageID)
+	defer c.forgetAck(messageID)
+
+	ctx, span := c.tracer.Start(ctx, "send "+identifier)
+	defer span.End()
+	headers := map[string]string{MessageIDHeader: messageID}
+	for key, value := range traceHeaders(span) {
+		headers[key] = value
+	}
+	// retries carry the same data, hence the same message id
+	action := rotonde.Action{identifier, c.attachMetadata("action", identifier, data, headers)}
+
+	backoff := options.InitialBackoff
+	for {
+		select {
+		case c.jsonInChan <- action:
+		case <-ctx.Done():
+			return ackError(ctx)
+		}
+		select {
+		case <-acked:
+			return nil
+		case <-ctx.Done():
+			return ackError(ctx)
+		case <-time.After(backoff):
+		}
+		c.logger.Debug("action not acknowledged, retrying", Fields{"identifier": identifier, "message_id": messageID})
+		backoff *= 2
+		if backoff > options.MaxBackoff {
+			backoff = options.MaxBackoff
+		}
+	}
+}
+
+func ackError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrNotAcknowledged
+	}
+	return ctx.Err()
+}
+
+// expectAck returns a channel closed when messageID is acknowledged, the
+// ack event of identifier is listened to from the first call on.
+func (c *Client) expectAck(identifier, messageID string) chan bool {
+	acked := make(chan bool)
+	c.ackMutex.Lock()
+	c.pendingAcks[messageID] = acked
+	listening := c.ackListeners[identifier]
+	c.ackListeners[identifier] = true
+	c.ackMutex.Unlock()
+
+	if listening == false {
+		c.OnNamedEvent(AckIdentifier(identifier), func(m interface{}) bool {
+			id, _ := m.(rotonde.Event).Data["message_id"].(string)
+			c.ackMutex.Lock()
+			if pending, ok := c.pendingAcks[id]; ok {
+				close(pending)
+				delete(c.pendingAcks, id)
+			}
+			c.ackMutex.Unlock()
+			return true
+		})
+	}
+	return acked
+}
+
+func (c *Client) forgetAck(messageID string) {
+	c.ackMutex.Lock()
+	defer c.ackMutex.Unlock()
+	delete(c.pendingAcks, messageID)
+}
+
+// OnNamedActionAcked is OnNamedAction acknowledging the actions sent with
+// SendActionAcked once fn returns. Retried actions already handled are
+// acknowledged again without calling fn.
+func (c *Client) OnNamedActionAcked(identifier string, fn HandlerFunc) {
+	c.AddLocalDefinition(&rotonde.Definition{AckIdentifier(identifier), "event", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"message_id", "string", ""},
+	}})
+
+	handled := make(map[string]bool)
+	order := make([]string, 0, ackDedupSize)
+	c.OnNamedAction(identifier, func(m interface{}) bool {
+		metadata, _ := ActionMetadata(m.(rotonde.Action))
+		messageID := metadata.Headers[MessageIDHeader]
+		if messageID == "" {
+			return fn(m)
+		}
+		if handled[messageID] {
+			c.SendEvent(AckIdentifier(identifier), rotonde.Object{"message_id": messageID})
+			return true
+		}
+
+		if len(order) == ackDedupSize {
+			delete(handled, order[0])
+			order = order[1:]
+		}
+		handled[messageID] = true
+		order = append(order, messageID)
+
+		keep := fn(m)
+		c.SendEvent(AckIdentifier(identifier), rotonde.Object{"message_id": messageID})
+		return keep
+	})
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func TestActionAcked(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+
+	calls := make(chan rotonde.Action, 10)
+	c.OnNamedActionAcked("move", func(m interface{}) bool {
+		calls <- m.(rotonde.Action)
+		return true
+	})
+	if err := c.SendActionAcked(context.Background(), "move", rotonde.Object{"value": 1.0}, AckOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || valueOf((<-calls).Data) != 1 {
+		t.Fatal("handler not called once")
+	}
+}
+
+// retries keep their message id, and stop once one of them is acked.
+func TestActionAckedRetries(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+
+	messageIDs := make(chan string, 10)
+	c.OnNamedAction("move", func(m interface{}) bool {
+		metadata, _ := ActionMetadata(m.(rotonde.Action))
+		messageIDs <- metadata.Headers[MessageIDHeader]
+		if len(messageIDs) == 2 {
+			c.SendEvent(AckIdentifier("move"), rotonde.Object{"message_id": metadata.Headers[MessageIDHeader]})
+		}
+		return true
+	})
+	options := AckOptions{InitialBackoff: 10 * time.Millisecond, Timeout: 2 * time.Second}
+	if err := c.SendActionAcked(context.Background(), "move", rotonde.Object{}, options); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(messageIDs) != 2 {
+		t.Fatal("action sent ", len(messageIDs), " times, expected 2")
+	}
+	if first, second := <-messageIDs, <-messageIDs; first == "" || first != second {
+		t.Fatal("retried with message ids ", first, " and ", second)
+	}
+}
+
+func TestActionAckTimeout(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+
+	messageIDs := make(chan string, 10)
+	c.OnNamedAction("move", func(m interface{}) bool {
+		metadata, _ := ActionMetadata(m.(rotonde.Action))
+		messageIDs <- metadata.Headers[MessageIDHeader]
+		return true
+	})
+	start := time.Now()
+	err := c.SendActionAcked(context.Background(), "move", rotonde.Object{}, AckOptions{Timeout: 100 * time.Millisecond})
+	if err != ErrNotAcknowledged {
+		t.Fatal("unexpected error ", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Fatal("gave up after ", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.SendActionAcked(ctx, "move", rotonde.Object{}, AckOptions{}); err != context.Canceled {
+		t.Fatal("unexpected error ", err)
+	}
+
+	// the ack coming after the wait is ignored
+	c.SendEvent(AckIdentifier("move"), rotonde.Object{"message_id": <-messageIDs})
+	time.Sleep(50 * time.Millisecond)
+	c.ackMutex.Lock()
+	defer c.ackMutex.Unlock()
+	if len(c.pendingAcks) != 0 {
+		t.Fatal("pending acks not forgotten: ", c.pendingAcks)
+	}
+}
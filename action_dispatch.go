@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+type DispatchMode int
+
+const (
+	// DispatchSerial runs actions one after the other, in arrival order.
+	DispatchSerial DispatchMode = iota
+	// DispatchPool runs actions concurrently on Workers goroutines.
+	DispatchPool
+	// DispatchLatest only runs the most recent action, a new action skips
+	// the pending one and cancels the context of the running one.
+	DispatchLatest
+)
+
+// ActionPolicy describes how actions for an identifier are dispatched to
+// their handler. Actions arriving while the queue is full are dropped.
+type ActionPolicy struct {
+	Mode      DispatchMode
+	Workers   int
+	QueueSize int
+}
+
+// ActionHandlerFunc receives a context canceled when the client is closed,
+// or when the action is superseded with DispatchLatest. It carries the trace
+// context of the action.
+type ActionHandlerFunc func(ctx context.Context, action rotonde.Action)
+
+type queuedAction struct {
+	action     rotonde.Action
+	generation uint64
+}
+
+type actionDispatcher struct {
+	c      *Client
+	policy ActionPolicy
+	fn     ActionHandlerFunc
+	queue  chan queuedAction
+
+	mutex         *sync.Mutex
+	generation    uint64
+	cancelRunning context.CancelFunc
+}
+
+func (c *Client) OnNamedActionWithPolicy(identifier string, policy ActionPolicy, fn ActionHandlerFunc) {
+	d := &actionDispatcher{c: c, policy: policy, fn: fn, mutex: &sync.Mutex{}}
+
+	queueSize := policy.QueueSize
+	if queueSize < 1 {
+		queueSize = 10
+	}
+	workers := 1
+	switch policy.Mode {
+	case DispatchPool:
+		if policy.Workers > 1 {
+			workers = policy.Workers
+		}
+	case DispatchLatest:
+		queueSize = 1
+	}
+	d.queue = make(chan queuedAction, queueSize)
+
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+
+	c.OnNamedAction(identifier, func(m interface{}) bool {
+		select {
+		case <-c.ctx.Done():
+			return false
+		default:
+		}
+		d.push(m.(rotonde.Action))
+		return true
+	})
+}
+
+func (d *actionDispatcher) push(action rotonde.Action) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.generation++
+	queued := queuedAction{action, d.generation}
+	if d.policy.Mode == DispatchLatest {
+		select {
+		case <-d.queue:
+		default:
+		}
+		if d.cancelRunning != nil {
+			d.cancelRunning()
+		}
+	}
+	select {
+	case d.queue <- queued:
+	default:
+		d.c.logger.Warn("action queue full, dropping action", Fields{"identifier": action.Identifier})
+	}
+}
+
+func (d *actionDispatcher) work() {
+	for {
+		select {
+		case <-d.c.ctx.Done():
+			return
+		case queued := <-d.queue:
+			d.run(queued)
+		}
+	}
+}
+
+func (d *actionDispatcher) run(queued queuedAction) {
+	ctx, cancel := context.WithCancel(d.c.ctx)
+	defer cancel()
+
+	if d.policy.Mode == DispatchLatest {
+		d.mutex.Lock()
+		if queued.generation < d.generation {
+			d.mutex.Unlock()
+			return
+		}
+		d.cancelRunning = cancel
+		d.mutex.Unlock()
+	}
+	traceCtx, span := d.c.startHandlerSpan(ctx, queued.action.Identifier, queued.action.Data)
+	defer span.End()
+	d.fn(traceCtx, queued.action)
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func sendActions(c *Client, identifier string, values ...float64) {
+	for _, value := range values {
+		c.dispatcher.dispatch(rotonde.Action{identifier, rotonde.Object{"value": value}})
+	}
+}
+
+func TestActionDispatchSerial(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+
+	received := make(chan float64, 20)
+	c.OnNamedActionWithPolicy("move", ActionPolicy{Mode: DispatchSerial, QueueSize: 20}, func(ctx context.Context, action rotonde.Action) {
+		time.Sleep(time.Millisecond)
+		received <- valueOf(action.Data)
+	})
+	values := []float64{}
+	for i := 0; i < 20; i++ {
+		values = append(values, float64(i))
+	}
+	sendActions(c, "move", values...)
+
+	for _, expected := range values {
+		select {
+		case value := <-received:
+			if value != expected {
+				t.Fatal("received ", value, ", expected ", expected)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("action ", expected, " not handled")
+		}
+	}
+}
+
+func TestActionDispatchPool(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+
+	mutex := &sync.Mutex{}
+	running, maxRunning := 0, 0
+	wg := &sync.WaitGroup{}
+	wg.Add(12)
+	c.OnNamedActionWithPolicy("move", ActionPolicy{Mode: DispatchPool, Workers: 3, QueueSize: 20}, func(ctx context.Context, action rotonde.Action) {
+		defer wg.Done()
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+	})
+	sendActions(c, "move", 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)
+	wg.Wait()
+
+	if maxRunning != 3 {
+		t.Fatal(maxRunning, " actions ran concurrently, expected 3")
+	}
+}
+
+func TestActionDispatchLatest(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+
+	started := make(chan float64, 10)
+	canceled := make(chan float64, 10)
+	c.OnNamedActionWithPolicy("move", ActionPolicy{Mode: DispatchLatest}, func(ctx context.Context, action rotonde.Action) {
+		started <- valueOf(action.Data)
+		select {
+		case <-ctx.Done():
+			canceled <- valueOf(action.Data)
+		case <-time.After(time.Second):
+		}
+	})
+
+	sendActions(c, "move", 1)
+	if value := <-started; value != 1 {
+		t.Fatal("started ", value, ", expected 1")
+	}
+	sendActions(c, "move", 2)
+	select {
+	case value := <-canceled:
+		if value != 1 {
+			t.Fatal("canceled ", value, ", expected 1")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("superseded action not canceled")
+	}
+	select {
+	case value := <-started:
+		if value != 2 {
+			t.Fatal("started ", value, ", expected 2")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("latest action not started")
+	}
+}
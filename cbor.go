@@ -0,0 +1,254 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CBOR (RFC 7049) encoding of the generic values produced by binaryCodec.
+
+const (
+	cborUnsigned = 0 << 5
+	cborNegative = 1 << 5
+	cborBytes    = 2 << 5
+	cborText     = 3 << 5
+	cborArray    = 4 << 5
+	cborMap      = 5 << 5
+	cborTag      = 6 << 5
+	cborSimple   = 7 << 5
+)
+
+func writeCBORHead(buffer *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buffer.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buffer.WriteByte(major | 24)
+		buffer.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buffer.WriteByte(major | 25)
+		binary.Write(buffer, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buffer.WriteByte(major | 26)
+		binary.Write(buffer, binary.BigEndian, uint32(n))
+	default:
+		buffer.WriteByte(major | 27)
+		binary.Write(buffer, binary.BigEndian, n)
+	}
+}
+
+func encodeCBOR(buffer *bytes.Buffer, value interface{}) error {
+	value, err := genericValue(value)
+	if err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		buffer.WriteByte(cborSimple | 22)
+	case bool:
+		if v {
+			buffer.WriteByte(cborSimple | 21)
+		} else {
+			buffer.WriteByte(cborSimple | 20)
+		}
+	case int64:
+		if v >= 0 {
+			writeCBORHead(buffer, cborUnsigned, uint64(v))
+		} else {
+			writeCBORHead(buffer, cborNegative, uint64(-1-v))
+		}
+	case float64:
+		buffer.WriteByte(cborSimple | 27)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(v))
+	case string:
+		writeCBORHead(buffer, cborText, uint64(len(v)))
+		buffer.WriteString(v)
+	case []interface{}:
+		writeCBORHead(buffer, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := encodeCBOR(buffer, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		writeCBORHead(buffer, cborMap, uint64(len(v)))
+		for key, item := range v {
+			encodeCBOR(buffer, key)
+			if err := encodeCBOR(buffer, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New(fmt.Sprintf("cbor: cannot encode %T", value))
+	}
+	return nil
+}
+
+// cborBreak is returned by decodeCBOR when it meets the end of an
+// indefinite length item.
+type cborBreak struct{}
+
+var errUnexpectedBreak = errors.New("cbor: unexpected break")
+
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errTruncated
+	}
+	major, info, data := data[0]&0xe0, data[0]&0x1f, data[1:]
+
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		case 25:
+			n, rest, err := readUint(data, 2)
+			if err != nil {
+				return nil, nil, err
+			}
+			return halfToFloat(uint16(n)), rest, nil
+		case 26:
+			n, rest, err := readUint(data, 4)
+			if err != nil {
+				return nil, nil, err
+			}
+			return float64(math.Float32frombits(uint32(n))), rest, nil
+		case 27:
+			n, rest, err := readUint(data, 8)
+			if err != nil {
+				return nil, nil, err
+			}
+			return math.Float64frombits(n), rest, nil
+		case 31:
+			return cborBreak{}, data, nil
+		}
+		return nil, nil, errors.New(fmt.Sprint("cbor: unsupported simple value ", info))
+	}
+
+	indefinite := info == 31
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		var err error
+		n, data, err = readUint(data, 1<<(info-24))
+		if err != nil {
+			return nil, nil, err
+		}
+	case indefinite && (major == cborBytes || major == cborText || major == cborArray || major == cborMap):
+	default:
+		return nil, nil, errors.New(fmt.Sprint("cbor: invalid additional information ", info))
+	}
+
+	switch major {
+	case cborUnsigned:
+		if n > math.MaxInt64 {
+			return float64(n), data, nil
+		}
+		return int64(n), data, nil
+	case cborNegative:
+		if n > math.MaxInt64 {
+			return -1 - float64(n), data, nil
+		}
+		return -1 - int64(n), data, nil
+	case cborBytes, cborText:
+		if indefinite {
+			// concatenation of definite length chunks
+			s := ""
+			for {
+				chunk, rest, err := decodeCBOR(data)
+				if err != nil {
+					return nil, nil, err
+				}
+				data = rest
+				if _, ok := chunk.(cborBreak); ok {
+					return s, data, nil
+				}
+				str, ok := chunk.(string)
+				if ok == false {
+					return nil, nil, errors.New("cbor: invalid string chunk")
+				}
+				s += str
+			}
+		}
+		if uint64(len(data)) < n {
+			return nil, nil, errTruncated
+		}
+		return string(data[:n]), data[n:], nil
+	case cborArray:
+		array := make([]interface{}, 0)
+		for i := uint64(0); indefinite || i < n; i++ {
+			item, rest, err := decodeCBOR(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			data = rest
+			if _, ok := item.(cborBreak); ok {
+				if indefinite == false {
+					return nil, nil, errUnexpectedBreak
+				}
+				break
+			}
+			array = append(array, item)
+		}
+		return array, data, nil
+	case cborMap:
+		m := make(map[string]interface{})
+		for i := uint64(0); indefinite || i < n; i++ {
+			key, rest, err := decodeCBOR(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			data = rest
+			if _, ok := key.(cborBreak); ok {
+				if indefinite == false {
+					return nil, nil, errUnexpectedBreak
+				}
+				break
+			}
+			value, rest, err := decodeCBOR(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			data = rest
+			if _, ok := value.(cborBreak); ok {
+				return nil, nil, errUnexpectedBreak
+			}
+			m[fmt.Sprint(key)] = value
+		}
+		return m, data, nil
+	case cborTag:
+		// tags are ignored, only the tagged item is kept
+		return decodeCBOR(data)
+	}
+	return nil, nil, errors.New(fmt.Sprint("cbor: unsupported major type ", major>>5))
+}
+
+func halfToFloat(h uint16) float64 {
+	exponent := int(h>>10) & 0x1f
+	mantissa := float64(h & 0x3ff)
+	var f float64
+	switch exponent {
+	case 0:
+		f = math.Ldexp(mantissa, -24)
+	case 31:
+		if mantissa == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mantissa+1024, exponent-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// OverflowPolicy decides what happens when a channel returned by
+// EventsChan or ActionsChan is full. Unbuffered channels always block, as
+// dropping would lose every message the reader is not already waiting for.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drops the incoming message, the default.
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest buffered message to make room.
+	OverflowDropOldest
+	// OverflowBlock waits for the reader, delaying the other handlers of
+	// the identifier.
+	OverflowBlock
+)
+
+// chanSink guards a channel fed by a handler against being closed while
+// the handler writes to it.
+type chanSink struct {
+	mutex   *sync.Mutex
+	done    chan struct{}
+	stopped bool
+	policy  OverflowPolicy
+}
+
+func newChanSink(bufferSize int, policy []OverflowPolicy) *chanSink {
+	s := &chanSink{mutex: &sync.Mutex{}, done: make(chan struct{})}
+	if len(policy) > 0 {
+		s.policy = policy[0]
+	}
+	if bufferSize < 1 {
+		s.policy = OverflowBlock
+	}
+	return s
+}
+
+// closeOnDone stops s and calls closeFn once ctx or the client is done.
+func (c *Client) closeOnDone(ctx context.Context, s *chanSink, closeFn func()) {
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.ctx.Done():
+		}
+		close(s.done)
+		s.mutex.Lock()
+		s.stopped = true
+		s.mutex.Unlock()
+		closeFn()
+	}()
+}
+
+func (s *chanSink) active() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stopped == false
+}
+
+// deliver returns false once the sink is stopped, for the handler to detach.
+func (s *chanSink) deliver(trySend func() bool, dropOldest func(), blockSend func(done <-chan struct{})) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return false
+	}
+	if trySend() {
+		return true
+	}
+	switch s.policy {
+	case OverflowDropOldest:
+		dropOldest()
+		trySend()
+	case OverflowBlock:
+		blockSend(s.done)
+	}
+	return true
+}
+
+// EventsChan subscribes to identifier and returns its events on a channel,
+// closed with ctx or the client.
+func (c *Client) EventsChan(ctx context.Context, identifier string, bufferSize int, policy ...OverflowPolicy) <-chan rotonde.Event {
+	events := make(chan rotonde.Event, bufferSize)
+	sink := newChanSink(bufferSize, policy)
+	detach := c.attachNamedEvent(identifier, func(m interface{}) bool {
+		event := m.(rotonde.Event)
+		return sink.deliver(func() bool {
+			select {
+			case events <- event:
+				return true
+			default:
+				return false
+			}
+		}, func() {
+			select {
+			case <-events:
+			default:
+			}
+		}, func(done <-chan struct{}) {
+			select {
+			case events <- event:
+			case <-done:
+			}
+		})
+	}, false)
+	c.closeOnDone(ctx, sink, func() {
+		detach()
+		close(events)
+	})
+	return events
+}
+
+// ActionsChan returns the actions received for identifier on a channel,
+// closed with ctx or the client.
+func (c *Client) ActionsChan(ctx context.Context, identifier string, bufferSize int, policy ...OverflowPolicy) <-chan rotonde.Action {
+	actions := make(chan rotonde.Action, bufferSize)
+	sink := newChanSink(bufferSize, policy)
+	detach := c.dispatcher.attachNamed(kindAction, identifier, func(m interface{}) bool {
+		action := m.(rotonde.Action)
+		return sink.deliver(func() bool {
+			select {
+			case actions <- action:
+				return true
+			default:
+				return false
+			}
+		}, func() {
+			select {
+			case <-actions:
+			default:
+			}
+		}, func(done <-chan struct{}) {
+			select {
+			case actions <- action:
+			case <-done:
+			}
+		})
+	}, nil, nil, nil)
+	c.closeOnDone(ctx, sink, func() {
+		detach()
+		close(actions)
+	})
+	return actions
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func dispatchValues(c *Client, identifier string, values ...float64) {
+	for _, value := range values {
+		c.dispatcher.dispatch(rotonde.Event{identifier, rotonde.Object{"value": value}})
+	}
+}
+
+// drain reads events until none arrives for a while.
+func drain(events <-chan rotonde.Event) []float64 {
+	values := []float64{}
+	for {
+		select {
+		case event, ok := <-events:
+			if ok == false {
+				return values
+			}
+			values = append(values, valueOf(event.Data))
+		case <-time.After(100 * time.Millisecond):
+			return values
+		}
+	}
+}
+
+func TestEventsChanOverflow(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+
+	policies := []struct {
+		policy   OverflowPolicy
+		expected []float64
+	}{
+		{OverflowDropNewest, []float64{1, 2}},
+		{OverflowDropOldest, []float64{2, 3}},
+	}
+	for _, p := range policies {
+		ctx, cancel := context.WithCancel(context.Background())
+		events := c.EventsChan(ctx, "temp", 2, p.policy)
+		dispatchValues(c, "temp", 1, 2, 3)
+		time.Sleep(50 * time.Millisecond)
+		expectValues(t, drain(events), p.expected...)
+		cancel()
+	}
+}
+
+func TestEventsChanBlock(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+
+	// unbuffered channels block whatever the policy
+	channels := map[string]<-chan rotonde.Event{
+		"blocked":    c.EventsChan(context.Background(), "blocked", 1, OverflowBlock),
+		"unbuffered": c.EventsChan(context.Background(), "unbuffered", 0, OverflowDropNewest),
+	}
+	for identifier, events := range channels {
+		dispatchValues(c, identifier, 1, 2, 3, 4)
+		time.Sleep(50 * time.Millisecond)
+		expectValues(t, drain(events), 1, 2, 3, 4)
+	}
+}
+
+func TestEventsChanClose(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := c.EventsChan(ctx, "temp", 1)
+	closed := c.EventsChan(context.Background(), "temp", 1, OverflowBlock)
+
+	cancel()
+	if _, ok := <-canceled; ok {
+		t.Fatal("channel not closed with its context")
+	}
+	dispatchValues(c, "temp", 1, 2)
+	time.Sleep(50 * time.Millisecond)
+	// Close releases the blocked handler
+	c.Close()
+	if values := drain(closed); len(values) == 0 || values[0] != 1 {
+		t.Fatal("received ", values, " before close")
+	}
+	select {
+	case _, ok := <-closed:
+		if ok {
+			t.Fatal("unexpected event after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed with the client")
+	}
+}
+
+func TestActionsChan(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	actions := c.ActionsChan(ctx, "move", 10)
+
+	c.dispatcher.dispatch(rotonde.Action{"move", rotonde.Object{"value": 1.0}})
+	select {
+	case action := <-actions:
+		if action.Identifier != "move" || valueOf(action.Data) != 1 {
+			t.Fatal("unexpected action ", action)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("action not received")
+	}
+	cancel()
+	select {
+	case _, ok := <-actions:
+		if ok {
+			t.Fatal("unexpected action after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed with its context")
+	}
+}
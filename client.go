@@ -1,12 +1,13 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/HackerLoop/rotonde/shared"
-	"github.com/vitaminwater/handlers-go"
 )
 
 // TODO dry
@@ -14,65 +15,150 @@ import (
 type Client struct {
 	mutex *sync.Mutex
 
+	name         string
+	logger       Logger
+	connectionID uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	stateMutex    *sync.Mutex
+	state         State
+	stateHandlers []func(State)
+	endpoint      string
+
+	endpoints     []string
+	resolver      func() []string
+	preferPrimary time.Duration
+
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+
+	codecs []Codec
+
+	subscriptionMutex *sync.Mutex
+	subscriptions     map[string]int
+	session           uint64
+
 	localDefinitions  map[string]rotonde.Definitions
 	remoteDefinitions map[string]rotonde.Definitions
 
-	jsonOutChan chan interface{}
-	jsonInChan  chan interface{}
+	jsonInChan chan interface{}
+
+	throttleMutex *sync.Mutex
+	throttles     map[string]*throttle
+
+	historyMutex *sync.Mutex
+	histories    map[string]*history
+
+	dispatcher *dispatcher
+
+	tracer Tracer
 
-	definitionHandler         *handlers.HandlerManager
-	namedDefinitionHandlers   map[string]*handlers.HandlerManager
-	unDefinitionHandler       *handlers.HandlerManager
-	namedUnDefinitionHandlers map[string]*handlers.HandlerManager
-	eventHandler              *handlers.HandlerManager
-	namedEventHandlers        map[string]*handlers.HandlerManager
-	actionHandler             *handlers.HandlerManager
-	namedActionHandlers       map[string]*handlers.HandlerManager
+	metadata      bool
+	moduleID      string
+	sequenceMutex *sync.Mutex
+	sequences     map[string]uint64
+
+	ackMutex     *sync.Mutex
+	pendingAcks  map[string]chan bool
+	ackListeners map[string]bool
+
+	jobMutex     *sync.Mutex
+	jobs         map[string]*Job
+	jobListeners map[string]bool
+
+	interceptorMutex      *sync.Mutex
+	inboundInterceptors   []Interceptor
+	outboundInterceptors  []Interceptor
+	unknownPacketHandlers []func(int, []byte)
 }
 
-func NewClient(rotondeUrl string) (c *Client) {
+func NewClient(rotondeUrl string, options ...Option) (c *Client) {
 	c = new(Client)
+	c.logger = SlogLogger(nil)
+	c.tracer = nopTracer{}
+	c.endpoints = []string{rotondeUrl}
+	for _, option := range options {
+		option(c)
+	}
+	// the endpoint may change with failovers, it is added per connection
+	c.logger = withFields(c.logger, Fields{"client": c.name})
+
 	c.mutex = &sync.Mutex{}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.stateMutex = &sync.Mutex{}
+	c.subscriptionMutex = &sync.Mutex{}
+	c.subscriptions = make(map[string]int)
 	c.localDefinitions = make(map[string]rotonde.Definitions)
 	c.remoteDefinitions = make(map[string]rotonde.Definitions)
 
-	c.jsonOutChan = make(chan interface{}, 100)
 	c.jsonInChan = make(chan interface{}, 100)
 
-	go startConnection(rotondeUrl, c.jsonInChan, c.jsonOutChan)
+	c.throttleMutex = &sync.Mutex{}
+	c.throttles = make(map[string]*throttle)
 
-	mainHandler := handlers.NewHandlerManager(c.jsonOutChan, handlers.PassAll, handlers.Noop, handlers.Noop)
+	c.historyMutex = &sync.Mutex{}
+	c.histories = make(map[string]*history)
 
-	c.definitionHandler = handlers.NewHandlerManager(make(chan interface{}, 10), func(m interface{}) (r interface{}, ok bool) { r, ok = m.(rotonde.Definition); return }, handlers.Noop, handlers.Noop)
-	mainHandler.AddOutChan(c.definitionHandler.InChan)
-	c.namedDefinitionHandlers = make(map[string]*handlers.HandlerManager)
+	c.sequenceMutex = &sync.Mutex{}
+	c.sequences = make(map[string]uint64)
 
-	c.definitionHandler.Attach(func(d interface{}) bool {
-		def := d.(rotonde.Definition)
-		c.addRemoteDefinition(&def)
-		return true
-	})
+	c.ackMutex = &sync.Mutex{}
+	c.pendingAcks = make(map[string]chan bool)
+	c.ackListeners = make(map[string]bool)
 
-	c.unDefinitionHandler = handlers.NewHandlerManager(make(chan interface{}, 10), func(m interface{}) (r interface{}, ok bool) { r, ok = m.(rotonde.UnDefinition); return }, handlers.Noop, handlers.Noop)
-	mainHandler.AddOutChan(c.unDefinitionHandler.InChan)
-	c.namedUnDefinitionHandlers = make(map[string]*handlers.HandlerManager)
+	c.jobMutex = &sync.Mutex{}
+	c.jobs = make(map[string]*Job)
+	c.jobListeners = make(map[string]bool)
 
-	c.unDefinitionHandler.Attach(func(d interface{}) bool {
-		def := d.(rotonde.UnDefinition)
-		c.removeRemoteDefinition(def.Type, def.Identifier)
-		return true
-	})
+	c.interceptorMutex = &sync.Mutex{}
 
-	c.eventHandler = handlers.NewHandlerManager(make(chan interface{}, 10), func(m interface{}) (r interface{}, ok bool) { r, ok = m.(rotonde.Event); return }, handlers.Noop, handlers.Noop)
-	mainHandler.AddOutChan(c.eventHandler.InChan)
-	c.namedEventHandlers = make(map[string]*handlers.HandlerManager)
+	c.dispatcher = newDispatcher(c.ctx, c.record)
 
-	c.actionHandler = handlers.NewHandlerManager(make(chan interface{}, 10), func(m interface{}) (r interface{}, ok bool) { r, ok = m.(rotonde.Action); return }, handlers.Noop, handlers.Noop)
-	mainHandler.AddOutChan(c.actionHandler.InChan)
-	c.namedActionHandlers = make(map[string]*handlers.HandlerManager)
+	go c.startConnection()
 	return
 }
 
+func (c *Client) Logger() Logger {
+	return c.logger
+}
+
+// flushTimeout bounds the time Close waits for the queued packets to be
+// written.
+const flushTimeout = 2 * time.Second
+
+// flushPacket is closed by the writer once the packets queued before it
+// are written.
+type flushPacket chan bool
+
+// Close writes the queued packets when connected, then stops the
+// connection to rotonde and cancels the contexts given to action handlers.
+func (c *Client) Close() {
+	if c.State() == Connected {
+		c.flush(flushTimeout)
+	}
+	c.setState(Closed)
+	c.cancel()
+}
+
+func (c *Client) flush(timeout time.Duration) bool {
+	done := make(flushPacket)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case c.jsonInChan <- done:
+	case <-timer.C:
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
 func (c *Client) addRemoteDefinition(d *rotonde.Definition) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -110,9 +196,48 @@ func (c *Client) GetRemoteDefinition(typ string, identifier string) (*rotonde.De
 	return d, err
 }
 
-func (c *Client) AddLocalDefinition(d *rotonde.Definition) {
+// GetRemoteDefinitions returns all the definitions received from rotonde,
+// an empty typ returns both actions and events.
+func (c *Client) GetRemoteDefinitions(typ string) rotonde.Definitions {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return collectDefinitions(c.remoteDefinitions, typ)
+}
+
+// GetLocalDefinitions returns the definitions declared by this client, an
+// empty typ returns both actions and events.
+func (c *Client) GetLocalDefinitions(typ string) rotonde.Definitions {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return collectDefinitions(c.localDefinitions, typ)
+}
+
+func collectDefinitions(byType map[string]rotonde.Definitions, typ string) rotonde.Definitions {
+	result := make(rotonde.Definitions, 0, 10)
+	for t, definitions := range byType {
+		if typ != "" && t != typ {
+			continue
+		}
+		result = append(result, definitions...)
+	}
+	return result
+}
+
+func (c *Client) getLocalDefinition(typ string, identifier string) (*rotonde.Definition, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	definitions, ok := c.localDefinitions[typ]
+	if ok == false {
+		return nil, errors.New(fmt.Sprint(identifier, " Not found"))
+	}
+	return definitions.GetDefinitionForIdentifier(identifier)
+}
+
+func (c *Client) AddLocalDefinition(d *rotonde.Definition) {
+	if err := ValidateUnits(d); err != nil {
+		c.logger.Warn("invalid units", Fields{"identifier": d.Identifier, "error": err})
+	}
+	c.mutex.Lock()
 	definitions, ok := c.localDefinitions[d.Type]
 	if ok == false {
 		definitions = make([]*rotonde.Definition, 0, 10)
@@ -120,27 +245,33 @@ func (c *Client) AddLocalDefinition(d *rotonde.Definition) {
 	}
 	_, err := definitions.GetDefinitionForIdentifier(d.Identifier)
 	if err == nil {
+		c.mutex.Unlock()
 		return
 	}
 	definitions = append(definitions, d)
 	c.localDefinitions[d.Type] = definitions
-	c.jsonInChan <- *d
+	session := c.session
+	c.mutex.Unlock()
+	c.jsonInChan <- sessionPacket{session, *d}
 }
 
 func (c *Client) RemoveLocalDefinition(typ string, identifier string) {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
 	definitions, ok := c.localDefinitions[typ]
 	if ok == false {
+		c.mutex.Unlock()
 		return
 	}
 	definition, err := definitions.GetDefinitionForIdentifier(identifier)
 	if err != nil {
+		c.mutex.Unlock()
 		return
 	}
 	definitions = rotonde.RemoveDefinition(definitions, identifier)
 	c.localDefinitions[typ] = definitions
-	c.jsonInChan <- rotonde.UnDefinition{definition.Identifier, definition.Type, definition.IsArray, definition.Fields}
+	session := c.session
+	c.mutex.Unlock()
+	c.jsonInChan <- sessionPacket{session, rotonde.UnDefinition{definition.Identifier, definition.Type, definition.IsArray, definition.Fields}}
 }
 
 func (c *Client) SendMessage(message interface{}) {
@@ -148,6 +279,17 @@ func (c *Client) SendMessage(message interface{}) {
 }
 
 func (c *Client) SendEvent(identifier string, data rotonde.Object) {
+	c.SendEventContext(context.Background(), identifier, data)
+}
+
+// SendEventContext is SendEvent propagating the trace context of ctx.
+func (c *Client) SendEventContext(ctx context.Context, identifier string, data rotonde.Object) {
+	_, span := c.tracer.Start(ctx, "send "+identifier)
+	defer span.End()
+	data = c.attachMetadata("event", identifier, data, traceHeaders(span))
+	if c.throttleEvent(identifier, data) == false {
+		return
+	}
 	c.jsonInChan <- rotonde.Event{
 		identifier,
 		data,
@@ -155,76 +297,85 @@ func (c *Client) SendEvent(identifier string, data rotonde.Object) {
 }
 
 func (c *Client) SendAction(identifier string, data rotonde.Object) {
+	c.SendActionContext(context.Background(), identifier, data)
+}
+
+// SendActionContext is SendAction propagating the trace context of ctx.
+func (c *Client) SendActionContext(ctx context.Context, identifier string, data rotonde.Object) {
+	c.sendAction(ctx, identifier, data, nil)
+}
+
+func (c *Client) sendAction(ctx context.Context, identifier string, data rotonde.Object, headers map[string]string) {
+	_, span := c.tracer.Start(ctx, "send "+identifier)
+	defer span.End()
+	for key, value := range traceHeaders(span) {
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[key] = value
+	}
+	data = c.attachMetadata("action", identifier, data, headers)
 	c.jsonInChan <- rotonde.Action{
 		identifier,
 		data,
 	}
 }
 
-func (c *Client) OnDefinition(fn handlers.HandlerFunc) {
-	c.definitionHandler.Attach(fn)
+func (c *Client) OnDefinition(fn HandlerFunc) {
+	c.dispatcher.attach(kindDefinition, fn)
 }
 
-func (c *Client) OnNamedDefinition(identifier string, fn handlers.HandlerFunc) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	handler, ok := c.namedDefinitionHandlers[identifier]
-	if ok == false {
-		handler = handlers.NewHandlerManager(make(chan interface{}, 10), func(m interface{}) (interface{}, bool) { return m, m.(rotonde.Definition).Identifier == identifier }, handlers.Noop, handlers.Noop)
-		c.definitionHandler.AddOutChan(handler.InChan)
-		c.namedDefinitionHandlers[identifier] = handler
-	}
-	handler.Attach(fn)
+// AttachDefinition is OnDefinition returning the function detaching fn.
+func (c *Client) AttachDefinition(fn HandlerFunc) func() {
+	return c.dispatcher.attach(kindDefinition, fn)
 }
 
-func (c *Client) OnUnDefinition(fn handlers.HandlerFunc) {
-	c.unDefinitionHandler.Attach(fn)
+func (c *Client) OnNamedDefinition(identifier string, fn HandlerFunc) {
+	c.dispatcher.attachNamed(kindDefinition, identifier, fn, nil, nil, nil)
 }
 
-func (c *Client) OnNamedUnDefinition(identifier string, fn handlers.HandlerFunc) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	handler, ok := c.namedUnDefinitionHandlers[identifier]
-	if ok == false {
-		handler = handlers.NewHandlerManager(make(chan interface{}, 10), func(m interface{}) (interface{}, bool) { return m, m.(rotonde.UnDefinition).Identifier == identifier }, handlers.Noop, handlers.Noop)
-		c.unDefinitionHandler.AddOutChan(handler.InChan)
-		c.namedUnDefinitionHandlers[identifier] = handler
-	}
-	handler.Attach(fn)
+func (c *Client) OnUnDefinition(fn HandlerFunc) {
+	c.dispatcher.attach(kindUnDefinition, fn)
 }
 
-func (c *Client) OnEvent(fn handlers.HandlerFunc) {
-	c.eventHandler.Attach(fn)
+// AttachUnDefinition is OnUnDefinition returning the function detaching fn.
+func (c *Client) AttachUnDefinition(fn HandlerFunc) func() {
+	return c.dispatcher.attach(kindUnDefinition, fn)
 }
 
-func (c *Client) OnNamedEvent(identifier string, fn handlers.HandlerFunc) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	handler, ok := c.namedEventHandlers[identifier]
-	if ok == false {
-		handler = handlers.NewHandlerManager(make(chan interface{}, 10), func(m interface{}) (interface{}, bool) { return m, m.(rotonde.Event).Identifier == identifier }, func() {
-			c.SendMessage(rotonde.Subscription{identifier})
-		}, func() {
-			c.SendMessage(rotonde.Unsubscription{identifier})
-		})
-		c.eventHandler.AddOutChan(handler.InChan)
-		c.namedEventHandlers[identifier] = handler
-	}
-	handler.Attach(fn)
+func (c *Client) OnNamedUnDefinition(identifier string, fn HandlerFunc) {
+	c.dispatcher.attachNamed(kindUnDefinition, identifier, fn, nil, nil, nil)
 }
 
-func (c *Client) OnAction(fn handlers.HandlerFunc) {
-	c.actionHandler.Attach(fn)
+func (c *Client) OnEvent(fn HandlerFunc) {
+	c.dispatcher.attach(kindEvent, fn)
 }
 
-func (c *Client) OnNamedAction(identifier string, fn handlers.HandlerFunc) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	handler, ok := c.namedActionHandlers[identifier]
-	if ok == false {
-		handler = handlers.NewHandlerManager(make(chan interface{}, 10), func(m interface{}) (interface{}, bool) { return m, m.(rotonde.Action).Identifier == identifier }, handlers.Noop, handlers.Noop)
-		c.actionHandler.AddOutChan(handler.InChan)
-		c.namedActionHandlers[identifier] = handler
+func (c *Client) OnNamedEvent(identifier string, fn HandlerFunc) {
+	c.attachNamedEvent(identifier, fn, true)
+}
+
+// attachNamedEvent attaches fn to the events of identifier, which are
+// subscribed to while handlers are attached, and returns the function
+// detaching it. With replay, fn first receives the latest retained event.
+func (c *Client) attachNamedEvent(identifier string, fn HandlerFunc, replay bool) func() {
+	var replayFn func() (interface{}, bool)
+	if replay {
+		replayFn = func() (interface{}, bool) {
+			return c.replayHistory(identifier)
+		}
 	}
-	handler.Attach(fn)
+	return c.dispatcher.attachNamed(kindEvent, identifier, fn, func() {
+		c.subscribe(identifier)
+	}, func() {
+		c.unsubscribe(identifier)
+	}, replayFn)
+}
+
+func (c *Client) OnAction(fn HandlerFunc) {
+	c.dispatcher.attach(kindAction, fn)
+}
+
+func (c *Client) OnNamedAction(identifier string, fn HandlerFunc) {
+	c.dispatcher.attachNamed(kindAction, identifier, fn, nil, nil, nil)
 }
@@ -0,0 +1,336 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/HackerLoop/rotonde/shared"
+	"github.com/gorilla/websocket"
+)
+
+// Codec encodes packets on the websocket. Its name is offered as a
+// websocket subprotocol during the handshake, servers not selecting any of
+// the offered codecs get JSON text frames.
+type Codec interface {
+	Name() string
+	// MessageType is websocket.TextMessage or websocket.BinaryMessage.
+	MessageType() int
+	Encode(packet interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string     { return "rotonde.json" }
+func (jsonCodec) MessageType() int { return websocket.TextMessage }
+
+func (jsonCodec) Encode(packet interface{}) ([]byte, error) {
+	return rotonde.ToJSON(packet)
+}
+
+func (jsonCodec) Decode(data []byte) (interface{}, error) {
+	return rotonde.FromJSON(bytes.NewReader(data))
+}
+
+var (
+	JSONCodec        Codec = jsonCodec{}
+	MessagePackCodec Codec = binaryCodec{"rotonde.msgpack", encodeMessagePack, decodeMessagePack}
+	CBORCodec        Codec = binaryCodec{"rotonde.cbor", encodeCBOR, decodeCBOR}
+)
+
+// binaryCodec encodes packets with the layout of their JSON encoding,
+// {"type": "event", "payload": {"identifier": ..., "data": ...}}, made of
+// generic values (nil, bool, int64, float64, string, []interface{} and
+// map[string]interface{}) which are then encoded in a binary format.
+type binaryCodec struct {
+	name   string
+	encode func(buffer *bytes.Buffer, value interface{}) error
+	decode func(data []byte) (interface{}, []byte, error)
+}
+
+func (b binaryCodec) Name() string     { return b.name }
+func (b binaryCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (b binaryCodec) Encode(packet interface{}) ([]byte, error) {
+	value, err := packetValue(packet)
+	if err != nil {
+		return nil, err
+	}
+	buffer := &bytes.Buffer{}
+	if err := b.encode(buffer, value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (b binaryCodec) Decode(data []byte) (interface{}, error) {
+	value, _, err := b.decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return valuePacket(value)
+}
+
+func packetValue(packet interface{}) (interface{}, error) {
+	var payload map[string]interface{}
+	switch p := packet.(type) {
+	case rotonde.Event:
+		payload = map[string]interface{}{"identifier": p.Identifier, "data": objectValue(p.Data)}
+	case rotonde.Action:
+		payload = map[string]interface{}{"identifier": p.Identifier, "data": objectValue(p.Data)}
+	case rotonde.Definition:
+		payload = definitionValue(p)
+	case rotonde.UnDefinition:
+		payload = definitionValue(rotonde.Definition(p))
+	case rotonde.Subscription:
+		payload = map[string]interface{}{"identifier": p.Identifier}
+	case rotonde.Unsubscription:
+		payload = map[string]interface{}{"identifier": p.Identifier}
+	default:
+		return nil, errors.New(fmt.Sprintf("cannot encode %T", packet))
+	}
+	return map[string]interface{}{"type": packetType(packet), "payload": payload}, nil
+}
+
+func objectValue(data rotonde.Object) interface{} {
+	if data == nil {
+		return nil
+	}
+	return map[string]interface{}(data)
+}
+
+func definitionValue(d rotonde.Definition) map[string]interface{} {
+	var fields interface{}
+	if d.Fields != nil {
+		values := make([]interface{}, 0, len(d.Fields))
+		for _, field := range d.Fields {
+			if field == nil {
+				values = append(values, nil)
+				continue
+			}
+			values = append(values, map[string]interface{}{"name": field.Name, "type": field.Type, "units": field.Units})
+		}
+		fields = values
+	}
+	return map[string]interface{}{"identifier": d.Identifier, "type": d.Type, "isarray": d.IsArray, "fields": fields}
+}
+
+func valuePacket(value interface{}) (interface{}, error) {
+	packet, ok := value.(map[string]interface{})
+	if ok == false {
+		return nil, errors.New("invalid packet")
+	}
+	typ, err := stringValue(packet, "type")
+	if err != nil {
+		return nil, err
+	}
+	payload, ok := packet["payload"].(map[string]interface{})
+	if ok == false {
+		return nil, errors.New(fmt.Sprint("invalid ", typ, " packet, no payload"))
+	}
+	identifier, err := stringValue(payload, "identifier")
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case "event":
+		data, err := objectField(payload, "data")
+		return rotonde.Event{identifier, data}, err
+	case "action":
+		data, err := objectField(payload, "data")
+		return rotonde.Action{identifier, data}, err
+	case "def":
+		return valueDefinition(identifier, payload)
+	case "undef":
+		d, err := valueDefinition(identifier, payload)
+		return rotonde.UnDefinition(d), err
+	case "sub":
+		return rotonde.Subscription{identifier}, nil
+	case "unsub":
+		return rotonde.Unsubscription{identifier}, nil
+	}
+	return nil, errors.New(fmt.Sprint("unknown packet type ", typ))
+}
+
+func valueDefinition(identifier string, payload map[string]interface{}) (d rotonde.Definition, err error) {
+	d.Identifier = identifier
+	if d.Type, err = stringValue(payload, "type"); err != nil {
+		return d, err
+	}
+	if isArray, ok := payload["isarray"].(bool); ok {
+		d.IsArray = isArray
+	} else if payload["isarray"] != nil {
+		return d, errors.New("invalid packet, isarray is not a boolean")
+	}
+	if payload["fields"] == nil {
+		return d, nil
+	}
+	fields, ok := payload["fields"].([]interface{})
+	if ok == false {
+		return d, errors.New("invalid packet, fields is not an array")
+	}
+	d.Fields = make(rotonde.FieldDefinitions, 0, len(fields))
+	for _, value := range fields {
+		if value == nil {
+			d.Fields = append(d.Fields, nil)
+			continue
+		}
+		field, ok := value.(map[string]interface{})
+		if ok == false {
+			return d, errors.New("invalid packet, field is not an object")
+		}
+		f := &rotonde.FieldDefinition{}
+		if f.Name, err = stringValue(field, "name"); err != nil {
+			return d, err
+		}
+		if f.Type, err = stringValue(field, "type"); err != nil {
+			return d, err
+		}
+		if f.Units, err = stringValue(field, "units"); err != nil {
+			return d, err
+		}
+		d.Fields = append(d.Fields, f)
+	}
+	return d, nil
+}
+
+// stringValue returns the string at key in m, an empty one when missing.
+func stringValue(m map[string]interface{}, key string) (string, error) {
+	switch v := m[key].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", errors.New(fmt.Sprint("invalid packet, ", key, " is not a string"))
+}
+
+// objectField returns the object at key in m, its numbers are float64 as
+// with JSON.
+func objectField(m map[string]interface{}, key string) (rotonde.Object, error) {
+	switch v := m[key].(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return rotonde.Object(floatNumbers(v).(map[string]interface{})), nil
+	}
+	return nil, errors.New(fmt.Sprint("invalid packet, ", key, " is not an object"))
+}
+
+// floatNumbers replaces int64 with float64.
+func floatNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = floatNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = floatNumbers(v[key])
+		}
+	}
+	return value
+}
+
+// genericValue converts the values found in the data of events and actions
+// to the generic values handled by the binary encodings, values of other
+// types go through their JSON representation.
+func genericValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, bool, int64, float64, string, []interface{}, map[string]interface{}:
+		return value, nil
+	case rotonde.Object:
+		return map[string]interface{}(v), nil
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint:
+		return genericValue(uint64(v))
+	case uint64:
+		if v > math.MaxInt64 {
+			return float64(v), nil
+		}
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case json.Number:
+		return genericNumbers(v), nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return genericNumbers(generic), nil
+}
+
+// genericNumbers replaces json.Number with int64 when possible, float64
+// otherwise.
+func genericNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = genericNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = genericNumbers(v[key])
+		}
+	}
+	return value
+}
+
+// WithCodecs offers codecs to rotonde, in order of preference. JSON
+// remains used when the server selects none of them.
+func WithCodecs(codecs ...Codec) Option {
+	return func(c *Client) {
+		c.codecs = codecs
+	}
+}
+
+func (c *Client) subprotocols() string {
+	names := make([]string, 0, len(c.codecs))
+	for _, codec := range c.codecs {
+		names = append(names, codec.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+func (c *Client) selectCodec(subprotocol string) Codec {
+	for _, codec := range c.codecs {
+		if codec.Name() == subprotocol {
+			return codec
+		}
+	}
+	return JSONCodec
+}
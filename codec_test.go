@@ -0,0 +1,172 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+var codecs = []Codec{JSONCodec, MessagePackCodec, CBORCodec}
+
+func testPackets() []interface{} {
+	many := rotonde.Object{}
+	for i := 0; i < 40; i++ {
+		many[fmt.Sprint("field", i)] = float64(i * 1000)
+	}
+	return []interface{}{
+		rotonde.Event{"temp", rotonde.Object{
+			"value":    21.5,
+			"negative": -40.0,
+			"large":    1e300,
+			"on":       true,
+			"off":      false,
+			"none":     nil,
+			"label":    strings.Repeat("é", 200),
+			"long":     strings.Repeat("x", 70000),
+			"nested":   map[string]interface{}{"values": []interface{}{1.0, "two", []interface{}{}}},
+		}},
+		rotonde.Event{"empty", nil},
+		rotonde.Action{"many", many},
+		rotonde.Definition{"temp", "event", true, rotonde.FieldDefinitions{
+			&rotonde.FieldDefinition{"value", "number", "°C"},
+			&rotonde.FieldDefinition{"label", "string", ""},
+		}},
+		rotonde.Definition{"ping", "action", false, nil},
+		rotonde.UnDefinition{"temp", "event", true, rotonde.FieldDefinitions{
+			&rotonde.FieldDefinition{"value", "number", "°C"},
+		}},
+		rotonde.Subscription{"temp"},
+		rotonde.Unsubscription{"temp"},
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range codecs {
+		for _, packet := range testPackets() {
+			data, err := codec.Encode(packet)
+			if err != nil {
+				t.Fatal(codec.Name(), ": ", err)
+			}
+			decoded, err := codec.Decode(data)
+			if err != nil {
+				t.Fatal(codec.Name(), ": ", err)
+			}
+			if reflect.DeepEqual(decoded, packet) == false {
+				t.Errorf("%v: decoded %.200v, expected %.200v", codec.Name(), decoded, packet)
+			}
+		}
+	}
+}
+
+type point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func TestCodecNumbersAndValues(t *testing.T) {
+	event := rotonde.Event{"values", rotonde.Object{
+		"int":    3,
+		"int64":  int64(-1) << 40,
+		"uint8":  uint8(200),
+		"uint64": uint64(1) << 63,
+		"float":  float32(0.5),
+		"object": rotonde.Object{"a": 1},
+		"point":  point{1, 2},
+		"list":   []string{"a", "b"},
+	}}
+	expected := rotonde.Event{"values", rotonde.Object{
+		"int":    3.0,
+		"int64":  float64(int64(-1) << 40),
+		"uint8":  200.0,
+		"uint64": float64(uint64(1) << 63),
+		"float":  0.5,
+		"object": map[string]interface{}{"a": 1.0},
+		"point":  map[string]interface{}{"x": 1.0, "y": 2.0},
+		"list":   []interface{}{"a", "b"},
+	}}
+	for _, codec := range codecs {
+		data, err := codec.Encode(event)
+		if err != nil {
+			t.Fatal(codec.Name(), ": ", err)
+		}
+		decoded, err := codec.Decode(data)
+		if err != nil {
+			t.Fatal(codec.Name(), ": ", err)
+		}
+		if reflect.DeepEqual(decoded, expected) == false {
+			t.Errorf("%v: decoded %v, expected %v", codec.Name(), decoded, expected)
+		}
+	}
+}
+
+func TestCodecTruncated(t *testing.T) {
+	for _, codec := range []Codec{MessagePackCodec, CBORCodec} {
+		for _, packet := range testPackets()[2:] {
+			data, err := codec.Encode(packet)
+			if err != nil {
+				t.Fatal(codec.Name(), ": ", err)
+			}
+			for i := 0; i < len(data); i++ {
+				if decoded, err := codec.Decode(data[:i]); err == nil {
+					t.Fatalf("%v: %v bytes out of %v decoded as %v", codec.Name(), i, len(data), decoded)
+				}
+			}
+		}
+	}
+}
+
+func TestCodecInvalidPackets(t *testing.T) {
+	values := []interface{}{
+		"event",
+		map[string]interface{}{"type": "event"},
+		map[string]interface{}{"type": "unknown", "payload": map[string]interface{}{}},
+		map[string]interface{}{"type": "event", "payload": map[string]interface{}{"identifier": 1.0}},
+		map[string]interface{}{"type": "event", "payload": map[string]interface{}{"data": "value"}},
+		map[string]interface{}{"type": "def", "payload": map[string]interface{}{"fields": map[string]interface{}{}}},
+		map[string]interface{}{"type": "def", "payload": map[string]interface{}{"fields": []interface{}{"value"}}},
+	}
+	for _, value := range values {
+		for _, encode := range []func(*bytes.Buffer, interface{}) error{encodeMessagePack, encodeCBOR} {
+			buffer := &bytes.Buffer{}
+			if err := encode(buffer, value); err != nil {
+				t.Fatal(err)
+			}
+			for _, codec := range []Codec{MessagePackCodec, CBORCodec} {
+				if decoded, err := codec.Decode(buffer.Bytes()); err == nil && packetType(decoded) != "" {
+					t.Errorf("%v decoded as %v", value, decoded)
+				}
+			}
+		}
+	}
+}
+
+func TestCBORBreak(t *testing.T) {
+	value, _, err := decodeCBOR([]byte{cborArray | 31, 0x01, 0x02, 0xff})
+	if err != nil || reflect.DeepEqual(value, []interface{}{int64(1), int64(2)}) == false {
+		t.Fatal("indefinite array decoded as ", value, err)
+	}
+	value, _, err = decodeCBOR([]byte{cborMap | 31, cborText | 1, 'a', 0x01, 0xff})
+	if err != nil || reflect.DeepEqual(value, map[string]interface{}{"a": int64(1)}) == false {
+		t.Fatal("indefinite map decoded as ", value, err)
+	}
+	value, _, err = decodeCBOR([]byte{cborText | 31, cborText | 1, 'a', cborText | 1, 'b', 0xff})
+	if err != nil || value != "ab" {
+		t.Fatal("indefinite string decoded as ", value, err)
+	}
+
+	stray := [][]byte{
+		{cborArray | 2, 0x01, 0xff},
+		{cborMap | 1, 0xff},
+		{cborMap | 1, cborText | 1, 'a', 0xff},
+		{cborMap | 31, cborText | 1, 'a', 0xff},
+	}
+	for _, data := range stray {
+		if value, _, err := decodeCBOR(data); err == nil {
+			t.Errorf("% x decoded as %v", data, value)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/HackerLoop/rotonde/shared"
+	"github.com/vitaminwater/handlers-go"
+)
+
+// HandlerFunc receives the messages it is attached to, returning false
+// detaches it.
+//
+// The handlers of an identifier are called in order from a goroutine of
+// their own, as are the kind-wide handlers (OnEvent, OnAction...) of each
+// kind. A handler that blocks delays the handlers sharing its goroutine,
+// and once mailboxSize messages are waiting for them, the reading of the
+// connection.
+//
+// It is the handler type of handlers-go, which the client used to dispatch
+// with, so existing handlers keep working.
+type HandlerFunc = handlers.HandlerFunc
+
+type messageKind int
+
+const (
+	kindDefinition messageKind = iota
+	kindUnDefinition
+	kindEvent
+	kindAction
+	kindCount
+)
+
+func messageKey(m interface{}) (messageKind, string, bool) {
+	switch message := m.(type) {
+	case rotonde.Definition:
+		return kindDefinition, message.Identifier, true
+	case rotonde.UnDefinition:
+		return kindUnDefinition, message.Identifier, true
+	case rotonde.Event:
+		return kindEvent, message.Identifier, true
+	case rotonde.Action:
+		return kindAction, message.Identifier, true
+	}
+	return 0, "", false
+}
+
+type handlerEntry struct {
+	fn       HandlerFunc
+	detached int32
+}
+
+// delivery carries a message to the entries attached when it was
+// dispatched.
+type delivery struct {
+	m       interface{}
+	entries []*handlerEntry
+}
+
+// mailboxSize bounds the deliveries queued for a worker.
+const mailboxSize = 100
+
+// mailbox is the bounded queue of a worker. Once it is full, dispatch waits
+// for the handlers, and the connection stops being read until they catch
+// up.
+type mailbox struct {
+	mutex      *sync.Mutex
+	cond       *sync.Cond
+	deliveries []delivery
+	closed     bool
+}
+
+func newMailbox() *mailbox {
+	b := &mailbox{mutex: &sync.Mutex{}}
+	b.cond = sync.NewCond(b.mutex)
+	return b
+}
+
+// push waits for room in the mailbox, unless force is set.
+func (b *mailbox) push(d delivery, force bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for force == false && b.closed == false && len(b.deliveries) >= mailboxSize {
+		b.cond.Wait()
+	}
+	if b.closed {
+		return
+	}
+	b.deliveries = append(b.deliveries, d)
+	b.cond.Broadcast()
+}
+
+func (b *mailbox) close() {
+	b.mutex.Lock()
+	b.closed = true
+	b.mutex.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *mailbox) next() (delivery, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for b.closed == false && len(b.deliveries) == 0 {
+		b.cond.Wait()
+	}
+	if b.closed {
+		return delivery{}, false
+	}
+	d := b.deliveries[0]
+	b.deliveries[0] = delivery{}
+	b.deliveries = b.deliveries[1:]
+	b.cond.Broadcast()
+	return d, true
+}
+
+// handlerSet is copied on write, deliveries keep the snapshot of the
+// entries they were dispatched to.
+type handlerSet struct {
+	kind       messageKind
+	identifier string
+	named      bool
+	entries    []*handlerEntry
+	onLast     func()
+	inbox      *mailbox
+}
+
+func (s *handlerSet) add(e *handlerEntry) {
+	entries := make([]*handlerEntry, len(s.entries), len(s.entries)+1)
+	copy(entries, s.entries)
+	s.entries = append(entries, e)
+}
+
+func (s *handlerSet) remove(e *handlerEntry) bool {
+	for i, entry := range s.entries {
+		if entry != e {
+			continue
+		}
+		entries := make([]*handlerEntry, 0, len(s.entries)-1)
+		entries = append(entries, s.entries[:i]...)
+		s.entries = append(entries, s.entries[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// dispatcher routes each received message with a map lookup on its kind
+// and identifier, to the worker of the kind-wide handlers and to the one of
+// the handlers named after the identifier.
+type dispatcher struct {
+	ctx   context.Context
+	mutex *sync.Mutex
+	kinds [kindCount]*handlerSet
+	named [kindCount]map[string]*handlerSet
+
+	// record is called under the lock with each message before it is
+	// queued, so that handlers see the client state updated.
+	record func(m interface{})
+
+	// callbacks are the pending onFirst and onLast calls, run in order
+	// outside the lock as they may block on the outbound queue.
+	callbackMutex *sync.Mutex
+	callbacks     []func()
+}
+
+func newDispatcher(ctx context.Context, record func(m interface{})) *dispatcher {
+	d := &dispatcher{ctx: ctx, mutex: &sync.Mutex{}, record: record, callbackMutex: &sync.Mutex{}}
+	for kind := range d.kinds {
+		d.kinds[kind] = &handlerSet{kind: messageKind(kind), inbox: newMailbox()}
+		d.named[kind] = make(map[string]*handlerSet)
+		go d.work(d.kinds[kind])
+	}
+	go d.closeOnDone()
+	return d
+}
+
+// closeOnDone stops the workers, and a dispatch waiting for them, once the
+// client is closed.
+func (d *dispatcher) closeOnDone() {
+	<-d.ctx.Done()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for kind := range d.kinds {
+		d.kinds[kind].inbox.close()
+		for _, set := range d.named[kind] {
+			set.inbox.close()
+		}
+	}
+}
+
+// attach returns the function detaching fn.
+func (d *dispatcher) attach(kind messageKind, fn HandlerFunc) func() {
+	e := &handlerEntry{fn: fn}
+	d.mutex.Lock()
+	set := d.kinds[kind]
+	set.add(e)
+	d.mutex.Unlock()
+	return func() {
+		d.detach(set, e)
+	}
+}
+
+// attachNamed returns the function detaching fn. onFirst is called when
+// the first handler of identifier is attached, and onLast when the last one
+// is detached. replay, when set, is called under the lock and the message
+// it returns is delivered to fn before any other.
+func (d *dispatcher) attachNamed(kind messageKind, identifier string, fn HandlerFunc, onFirst, onLast func(), replay func() (interface{}, bool)) func() {
+	e := &handlerEntry{fn: fn}
+	d.mutex.Lock()
+	set, ok := d.named[kind][identifier]
+	if ok == false {
+		set = &handlerSet{kind: kind, identifier: identifier, named: true, onLast: onLast, inbox: newMailbox()}
+		d.named[kind][identifier] = set
+		if d.ctx.Err() != nil {
+			set.inbox.close()
+		}
+		go d.work(set)
+		if onFirst != nil {
+			d.callbacks = append(d.callbacks, onFirst)
+		}
+	}
+	set.add(e)
+	if replay != nil {
+		// forced in, waiting for room under the lock would block the worker
+		if m, ok := replay(); ok {
+			set.inbox.push(delivery{m, []*handlerEntry{e}}, true)
+		}
+	}
+	d.mutex.Unlock()
+	d.runCallbacks()
+	return func() {
+		d.detach(set, e)
+	}
+}
+
+func (d *dispatcher) detach(set *handlerSet, e *handlerEntry) {
+	if atomic.CompareAndSwapInt32(&e.detached, 0, 1) == false {
+		return
+	}
+	d.mutex.Lock()
+	if set.remove(e) == false || set.named == false || len(set.entries) > 0 {
+		d.mutex.Unlock()
+		return
+	}
+	if d.named[set.kind][set.identifier] == set {
+		delete(d.named[set.kind], set.identifier)
+	}
+	set.inbox.close()
+	if set.onLast != nil {
+		d.callbacks = append(d.callbacks, set.onLast)
+	}
+	d.mutex.Unlock()
+	d.runCallbacks()
+}
+
+func (d *dispatcher) runCallbacks() {
+	d.callbackMutex.Lock()
+	defer d.callbackMutex.Unlock()
+	for {
+		d.mutex.Lock()
+		if len(d.callbacks) == 0 {
+			d.mutex.Unlock()
+			return
+		}
+		fn := d.callbacks[0]
+		d.callbacks = d.callbacks[1:]
+		d.mutex.Unlock()
+		fn()
+	}
+}
+
+// dispatch is called by the connection reader, handlers are then one
+// goroutine hop away. It waits while the mailbox of a handler set is full,
+// outside the lock as the worker may need it to detach a handler.
+func (d *dispatcher) dispatch(m interface{}) {
+	kind, identifier, ok := messageKey(m)
+	if ok == false {
+		return
+	}
+
+	var sets [2]*handlerSet
+	var deliveries [2]delivery
+	n := 0
+	d.mutex.Lock()
+	if d.record != nil {
+		d.record(m)
+	}
+	if set := d.kinds[kind]; len(set.entries) > 0 {
+		sets[n], deliveries[n] = set, delivery{m, set.entries}
+		n++
+	}
+	if set, ok := d.named[kind][identifier]; ok {
+		sets[n], deliveries[n] = set, delivery{m, set.entries}
+		n++
+	}
+	d.mutex.Unlock()
+
+	for i := 0; i < n; i++ {
+		sets[i].inbox.push(deliveries[i], false)
+	}
+}
+
+func (d *dispatcher) work(set *handlerSet) {
+	for {
+		delivery, ok := set.inbox.next()
+		if ok == false {
+			return
+		}
+		for _, e := range delivery.entries {
+			if atomic.LoadInt32(&e.detached) == 1 {
+				continue
+			}
+			if e.fn(delivery.m) == false {
+				d.detach(set, e)
+			}
+		}
+	}
+}
+
+// record keeps the remote definitions and the event histories up to date.
+func (c *Client) record(m interface{}) {
+	switch message := m.(type) {
+	case rotonde.Definition:
+		c.addRemoteDefinition(&message)
+	case rotonde.UnDefinition:
+		c.removeRemoteDefinition(message.Type, message.Identifier)
+	case rotonde.Event:
+		c.recordHistory(message)
+	}
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+	"github.com/vitaminwater/handlers-go"
+)
+
+// The On* methods still take handlers-go handlers.
+var _ func(*Client, string, handlers.HandlerFunc) = (*Client).OnNamedEvent
+
+// benchmarkDispatch measures the latency of an event, from the frame sent
+// by rotonde to the call of its handler among handlers named handlers.
+func benchmarkDispatch(b *testing.B, handlers int) {
+	f := newFakeRotonde(b)
+	defer f.close()
+	c := NewClient(f.url(), WithLogger(NopLogger()))
+	defer c.Close()
+
+	delivered := make(chan bool)
+	for i := 0; i < handlers; i++ {
+		c.OnNamedEvent(fmt.Sprint("event", i), func(m interface{}) bool {
+			delivered <- true
+			return true
+		})
+	}
+	waitState(b, c, Connected)
+	frame, err := JSONCodec.Encode(rotonde.Event{fmt.Sprint("event", handlers-1), rotonde.Object{"value": 1.0}})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := f.write(frame); err != nil {
+			b.Fatal(err)
+		}
+		<-delivered
+	}
+}
+
+// The latency of an event among 1, 100 and 10000 named handlers.
+func BenchmarkDispatch1(b *testing.B)     { benchmarkDispatch(b, 1) }
+func BenchmarkDispatch100(b *testing.B)   { benchmarkDispatch(b, 100) }
+func BenchmarkDispatch10000(b *testing.B) { benchmarkDispatch(b, 10000) }
+
+func TestDispatchOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := newDispatcher(ctx, nil)
+
+	received := make(chan float64, 100)
+	d.attachNamed(kindEvent, "a", func(m interface{}) bool {
+		received <- m.(rotonde.Event).Data["n"].(float64)
+		return true
+	}, nil, nil, nil)
+	blocked := make(chan bool)
+	d.attachNamed(kindEvent, "b", func(m interface{}) bool {
+		<-blocked
+		return true
+	}, nil, nil, nil)
+
+	d.dispatch(rotonde.Event{"b", nil})
+	for i := 0; i < 10; i++ {
+		d.dispatch(rotonde.Event{"a", rotonde.Object{"n": float64(i)}})
+	}
+	for i := 0; i < 10; i++ {
+		if n := <-received; n != float64(i) {
+			t.Fatalf("received %v, expected %v", n, i)
+		}
+	}
+	close(blocked)
+}
+
+func TestDispatchDetach(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := newDispatcher(ctx, nil)
+
+	first, last := make(chan bool, 1), make(chan bool, 1)
+	calls := make(chan bool, 10)
+	detach := d.attachNamed(kindEvent, "a", func(m interface{}) bool {
+		calls <- true
+		return false
+	}, func() { first <- true }, func() { last <- true }, nil)
+	<-first
+
+	d.dispatch(rotonde.Event{"a", nil})
+	<-last
+	d.dispatch(rotonde.Event{"a", nil})
+	detach()
+	if len(calls) != 1 {
+		t.Fatalf("handler called %v times after returning false", len(calls))
+	}
+}
+
+func TestDispatchWaitsForSlowHandlers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := newDispatcher(ctx, nil)
+
+	unblock := make(chan bool)
+	received := make(chan float64, 3*mailboxSize)
+	d.attachNamed(kindEvent, "a", func(m interface{}) bool {
+		<-unblock
+		received <- m.(rotonde.Event).Data["n"].(float64)
+		return true
+	}, nil, nil, nil)
+
+	dispatched := make(chan int, 3*mailboxSize)
+	go func() {
+		for i := 0; i < 3*mailboxSize; i++ {
+			d.dispatch(rotonde.Event{"a", rotonde.Object{"n": float64(i)}})
+			dispatched <- i
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// the handler holds one delivery, the mailbox the next ones
+	if len(dispatched) != mailboxSize+1 {
+		t.Fatalf("%v messages dispatched to a blocked handler", len(dispatched))
+	}
+
+	close(unblock)
+	for i := 0; i < 3*mailboxSize; i++ {
+		select {
+		case n := <-received:
+			if n != float64(i) {
+				t.Fatalf("received %v, expected %v", n, i)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%v messages received", i)
+		}
+	}
+}
+
+func TestDispatchStopsWaitingOnClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := newDispatcher(ctx, nil)
+	d.attachNamed(kindEvent, "a", func(m interface{}) bool {
+		<-ctx.Done()
+		return true
+	}, nil, nil, nil)
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 3*mailboxSize; i++ {
+			d.dispatch(rotonde.Event{"a", nil})
+		}
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("dispatch still waiting after close")
+	}
+}
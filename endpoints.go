@@ -0,0 +1,82 @@
+package client
+
+import (
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithEndpoints adds fallback endpoints, tried in order when the ones
+// before them cannot be reached.
+func WithEndpoints(urls ...string) Option {
+	return func(c *Client) {
+		c.endpoints = append(c.endpoints, urls...)
+	}
+}
+
+// WithEndpointResolver replaces the list of endpoints with the result of
+// resolve, called before each connection attempt.
+func WithEndpointResolver(resolve func() []string) Option {
+	return func(c *Client) {
+		c.resolver = resolve
+	}
+}
+
+// WithPreferPrimary makes a client connected to a fallback endpoint check
+// the primary every interval, and switch back to it once it is reachable.
+func WithPreferPrimary(interval time.Duration) Option {
+	return func(c *Client) {
+		c.preferPrimary = interval
+	}
+}
+
+func (c *Client) resolveEndpoints() []string {
+	if c.resolver != nil {
+		return c.resolver()
+	}
+	return c.endpoints
+}
+
+// Endpoint returns the endpoint the client is connected to, an empty
+// string when it is not connected.
+func (c *Client) Endpoint() string {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	return c.endpoint
+}
+
+func (c *Client) setEndpoint(endpoint string) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.endpoint = endpoint
+}
+
+func (c *Client) watchPrimary(conn *websocket.Conn, done chan bool, logger Logger) {
+	ticker := time.NewTicker(c.preferPrimary)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			endpoints := c.resolveEndpoints()
+			if len(endpoints) == 0 {
+				continue
+			}
+			u, err := url.Parse(endpoints[0])
+			if err != nil {
+				continue
+			}
+			probe, err := net.DialTimeout("tcp", u.Host, 2*time.Second)
+			if err != nil {
+				continue
+			}
+			probe.Close()
+			logger.Info("primary endpoint is back, switching", Fields{"endpoint": endpoints[0]})
+			conn.Close()
+			return
+		}
+	}
+}
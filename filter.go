@@ -0,0 +1,284 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// Filter is evaluated on the data of events or actions before they reach
+// their handlers.
+type Filter interface {
+	Match(data rotonde.Object) bool
+	// Validate checks the filter against the fields of a definition.
+	Validate(fields rotonde.FieldDefinitions) error
+}
+
+type comparisonOperator string
+
+const (
+	opEq  comparisonOperator = "=="
+	opNe  comparisonOperator = "!="
+	opGt  comparisonOperator = ">"
+	opGte comparisonOperator = ">="
+	opLt  comparisonOperator = "<"
+	opLte comparisonOperator = "<="
+)
+
+type comparison struct {
+	field string
+	op    comparisonOperator
+	value interface{}
+}
+
+func Eq(field string, value interface{}) Filter  { return comparison{field, opEq, value} }
+func Ne(field string, value interface{}) Filter  { return comparison{field, opNe, value} }
+func Gt(field string, value interface{}) Filter  { return comparison{field, opGt, value} }
+func Gte(field string, value interface{}) Filter { return comparison{field, opGte, value} }
+func Lt(field string, value interface{}) Filter  { return comparison{field, opLt, value} }
+func Lte(field string, value interface{}) Filter { return comparison{field, opLte, value} }
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// fieldType returns the rotonde type name of a value: number, string or boolean.
+func fieldType(value interface{}) string {
+	if _, ok := toFloat(value); ok {
+		return "number"
+	}
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func compareOrdered(op comparisonOperator, cmp int) bool {
+	switch op {
+	case opEq:
+		return cmp == 0
+	case opNe:
+		return cmp != 0
+	case opGt:
+		return cmp > 0
+	case opGte:
+		return cmp >= 0
+	case opLt:
+		return cmp < 0
+	case opLte:
+		return cmp <= 0
+	}
+	return false
+}
+
+func (f comparison) Match(data rotonde.Object) bool {
+	value, ok := data[f.field]
+	if ok == false {
+		return false
+	}
+	if a, ok := toFloat(value); ok {
+		b, ok := toFloat(f.value)
+		if ok == false {
+			return false
+		}
+		switch {
+		case a < b:
+			return compareOrdered(f.op, -1)
+		case a > b:
+			return compareOrdered(f.op, 1)
+		}
+		return compareOrdered(f.op, 0)
+	}
+	switch v := value.(type) {
+	case string:
+		s, ok := f.value.(string)
+		if ok == false {
+			return false
+		}
+		return compareOrdered(f.op, strings.Compare(v, s))
+	case bool:
+		b, ok := f.value.(bool)
+		if ok == false {
+			return false
+		}
+		switch f.op {
+		case opEq:
+			return v == b
+		case opNe:
+			return v != b
+		}
+	}
+	return false
+}
+
+func (f comparison) Validate(fields rotonde.FieldDefinitions) error {
+	for _, field := range fields {
+		if field == nil || field.Name != f.field {
+			continue
+		}
+		typ := fieldType(f.value)
+		// untyped fields can be compared with any value
+		if field.Type != "" && field.Type != typ {
+			return errors.New(fmt.Sprint(f.field, " is a ", field.Type, ", cannot compare with a ", typ))
+		}
+		if typ == "boolean" && f.op != opEq && f.op != opNe {
+			return errors.New(fmt.Sprint(f.field, " is a boolean, operator ", f.op, " not supported"))
+		}
+		return nil
+	}
+	return errors.New(fmt.Sprint(f.field, " Not found"))
+}
+
+type exists string
+
+// Exists matches when the field is present in the data.
+func Exists(field string) Filter {
+	return exists(field)
+}
+
+func (f exists) Match(data rotonde.Object) bool {
+	_, ok := data[string(f)]
+	return ok
+}
+
+func (f exists) Validate(fields rotonde.FieldDefinitions) error {
+	for _, field := range fields {
+		if field != nil && field.Name == string(f) {
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprint(string(f), " Not found"))
+}
+
+type and []Filter
+
+func And(filters ...Filter) Filter {
+	return and(filters)
+}
+
+func (f and) Match(data rotonde.Object) bool {
+	for _, filter := range f {
+		if filter.Match(data) == false {
+			return false
+		}
+	}
+	return true
+}
+
+func (f and) Validate(fields rotonde.FieldDefinitions) error {
+	for _, filter := range f {
+		if err := filter.Validate(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type or []Filter
+
+func Or(filters ...Filter) Filter {
+	return or(filters)
+}
+
+func (f or) Match(data rotonde.Object) bool {
+	for _, filter := range f {
+		if filter.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f or) Validate(fields rotonde.FieldDefinitions) error {
+	return and(f).Validate(fields)
+}
+
+type not struct {
+	filter Filter
+}
+
+func Not(filter Filter) Filter {
+	return not{filter}
+}
+
+func (f not) Match(data rotonde.Object) bool {
+	return f.filter.Match(data) == false
+}
+
+func (f not) Validate(fields rotonde.FieldDefinitions) error {
+	return f.filter.Validate(fields)
+}
+
+// Filtered wraps fn so that it only receives the events or actions matching filter.
+func Filtered(filter Filter, fn HandlerFunc) HandlerFunc {
+	return func(m interface{}) bool {
+		var data rotonde.Object
+		switch message := m.(type) {
+		case rotonde.Event:
+			data = message.Data
+		case rotonde.Action:
+			data = message.Data
+		default:
+			return true
+		}
+		if filter.Match(data) == false {
+			return true
+		}
+		return fn(m)
+	}
+}
+
+// OnNamedEventFiltered is OnNamedEvent with a filter, which is first
+// validated against the remote definition of the event when it is known.
+func (c *Client) OnNamedEventFiltered(identifier string, filter Filter, fn HandlerFunc) error {
+	if definition, err := c.GetRemoteDefinition("event", identifier); err == nil {
+		if err := filter.Validate(definition.Fields); err != nil {
+			return err
+		}
+	}
+	c.OnNamedEvent(identifier, Filtered(filter, fn))
+	return nil
+}
+
+// OnNamedActionFiltered validates filter against the local definition of
+// the action, actions are received by the module declaring them.
+func (c *Client) OnNamedActionFiltered(identifier string, filter Filter, fn HandlerFunc) error {
+	if definition, err := c.getLocalDefinition("action", identifier); err == nil {
+		if err := filter.Validate(definition.Fields); err != nil {
+			return err
+		}
+	}
+	c.OnNamedAction(identifier, Filtered(filter, fn))
+	return nil
+}
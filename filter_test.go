@@ -0,0 +1,96 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func TestFilterMatch(t *testing.T) {
+	data := rotonde.Object{"temp": 21.5, "room": "kitchen", "on": true}
+	filters := []struct {
+		filter   Filter
+		expected bool
+	}{
+		{Eq("temp", 21.5), true},
+		{Eq("temp", 21), false},
+		{Gt("temp", 20), true},
+		{Gte("temp", 21.5), true},
+		{Lt("temp", 21.5), false},
+		{Lte("temp", int64(22)), true},
+		{Ne("room", "bedroom"), true},
+		{Lt("room", "living"), true},
+		{Eq("on", true), true},
+		{Gt("on", false), false},
+		{Eq("temp", "21.5"), false},
+		{Eq("missing", 1), false},
+		{Exists("room"), true},
+		{Exists("missing"), false},
+		{And(Gt("temp", 20), Eq("room", "kitchen")), true},
+		{And(Gt("temp", 20), Eq("room", "bedroom")), false},
+		{Or(Eq("room", "bedroom"), Eq("on", true)), true},
+		{Not(Exists("missing")), true},
+		{And(), true},
+		{Or(), false},
+	}
+	for _, f := range filters {
+		if f.filter.Match(data) != f.expected {
+			t.Errorf("%#v on %v should be %v", f.filter, data, f.expected)
+		}
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	fields := rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"temp", "number", "°C"},
+		&rotonde.FieldDefinition{"room", "string", ""},
+		&rotonde.FieldDefinition{"on", "boolean", ""},
+		nil,
+		&rotonde.FieldDefinition{"payload", "", ""},
+	}
+	valid := []Filter{
+		Gt("temp", 20),
+		Eq("room", "kitchen"),
+		Ne("on", false),
+		And(Exists("temp"), Or(Lt("temp", 0), Not(Eq("on", true)))),
+		Eq("payload", "text"),
+		Gt("payload", 3),
+		Exists("payload"),
+	}
+	for _, filter := range valid {
+		if err := filter.Validate(fields); err != nil {
+			t.Errorf("%#v: %v", filter, err)
+		}
+	}
+	invalid := []Filter{
+		Eq("temp", "hot"),
+		Gt("on", true),
+		Eq("missing", 1),
+		Exists("missing"),
+		Or(Eq("room", "kitchen"), Eq("room", 1)),
+		Not(Lt("room", 3)),
+		Gt("payload", true),
+	}
+	for _, filter := range invalid {
+		if err := filter.Validate(fields); err == nil {
+			t.Errorf("%#v should not validate", filter)
+		}
+	}
+}
+
+func TestFiltered(t *testing.T) {
+	calls := 0
+	fn := Filtered(Gt("temp", 20), func(m interface{}) bool {
+		calls++
+		return false
+	})
+	if fn(rotonde.Event{"temp", rotonde.Object{"temp": 10.0}}) == false {
+		t.Fatal("filtered out events should keep the handler attached")
+	}
+	if fn(rotonde.Action{"temp", rotonde.Object{"temp": 30.0}}) {
+		t.Fatal("the result of the handler should be returned")
+	}
+	if calls != 1 {
+		t.Fatal("handler called ", calls, " times, expected 1")
+	}
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// maxActionSize bounds the body of POST /actions requests.
+const maxActionSize = 1 << 20
+
+// Gateway exposes the rotonde bus over HTTP:
+//
+//	GET  /definitions             lists the remote definitions
+//	POST /actions/{identifier}    sends an action, the body being its JSON data
+//	GET  /events/{identifier}     streams events as Server-Sent Events
+type Gateway struct {
+	c *Client
+}
+
+func NewGateway(c *Client) *Gateway {
+	return &Gateway{c: c}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/definitions":
+		g.serveDefinitions(w, r)
+	case strings.HasPrefix(r.URL.Path, "/actions/"):
+		g.serveAction(w, r, strings.TrimPrefix(r.URL.Path, "/actions/"))
+	case strings.HasPrefix(r.URL.Path, "/events/"):
+		g.serveEvents(w, r, strings.TrimPrefix(r.URL.Path, "/events/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (g *Gateway) serveDefinitions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.c.GetRemoteDefinitions(r.URL.Query().Get("type")))
+}
+
+func (g *Gateway) serveAction(w http.ResponseWriter, r *http.Request, identifier string) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	definition, err := g.c.GetRemoteDefinition("action", identifier)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	data := rotonde.Object{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxActionSize)).Decode(&data); err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok == true {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateData(definition, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g.c.SendAction(identifier, data)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (g *Gateway) serveEvents(w http.ResponseWriter, r *http.Request, identifier string) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if ok == false {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events := make(chan rotonde.Event, 16)
+	detach := g.c.attachNamedEvent(identifier, func(m interface{}) bool {
+		select {
+		case events <- m.(rotonde.Event):
+		default:
+			// slow client, the event is skipped rather than blocking the others
+		}
+		return true
+	}, false)
+	defer detach()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-g.c.ctx.Done():
+			return
+		case event := <-events:
+			data, err := json.Marshal(WithoutMetadata(event.Data))
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Identifier, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// validateData checks data against the fields of a definition, number,
+// string or boolean, or arrays of them when the definition IsArray.
+func validateData(definition *rotonde.Definition, data rotonde.Object) error {
+	for name, value := range data {
+		if name == MetadataKey {
+			continue
+		}
+		var field *rotonde.FieldDefinition
+		for _, f := range definition.Fields {
+			if f != nil && f.Name == name {
+				field = f
+				break
+			}
+		}
+		if field == nil {
+			return errors.New(fmt.Sprint("unknown field ", name, " for ", definition.Identifier))
+		}
+		values := []interface{}{value}
+		if definition.IsArray {
+			array, ok := value.([]interface{})
+			if ok == false {
+				return errors.New(fmt.Sprint(name, " must be an array"))
+			}
+			values = array
+		}
+		for _, v := range values {
+			if field.Type != "" && fieldType(v) != field.Type {
+				return errors.New(fmt.Sprint(name, " must be a ", field.Type))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func newGatewayClient() *Client {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	c.addRemoteDefinition(&rotonde.Definition{"move", "action", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"speed", "number", "m/s"},
+		nil,
+		&rotonde.FieldDefinition{"label", "string", ""},
+	}})
+	c.addRemoteDefinition(&rotonde.Definition{"temp", "event", false, nil})
+	return c
+}
+
+func TestGatewayDefinitions(t *testing.T) {
+	c := newGatewayClient()
+	defer c.Close()
+	g := NewGateway(c)
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/definitions?type=action", nil))
+	definitions := rotonde.Definitions{}
+	if err := json.NewDecoder(w.Body).Decode(&definitions); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(definitions) != 1 || definitions[0].Identifier != "move" {
+		t.Fatal("unexpected definitions ", w.Code, definitions)
+	}
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("POST", "/definitions", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatal("POST /definitions returned ", w.Code)
+	}
+}
+
+func TestGatewayAction(t *testing.T) {
+	c := newGatewayClient()
+	defer c.Close()
+	g := NewGateway(c)
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("POST", "/actions/move", strings.NewReader(`{"speed": 2, "label": "fast"}`)))
+	if w.Code != http.StatusAccepted {
+		t.Fatal("valid action returned ", w.Code, " ", w.Body)
+	}
+	select {
+	case packet := <-c.jsonInChan:
+		action, ok := packet.(rotonde.Action)
+		if ok == false || action.Identifier != "move" || action.Data["speed"] != 2.0 {
+			t.Fatal("unexpected packet ", packet)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("action not sent")
+	}
+
+	requests := []struct {
+		method, path, body string
+		expected           int
+	}{
+		{"GET", "/actions/move", "", http.StatusMethodNotAllowed},
+		{"POST", "/actions/jump", `{}`, http.StatusNotFound},
+		{"POST", "/actions/move", `{"speed": "fast"}`, http.StatusBadRequest},
+		{"POST", "/actions/move", `{"unknown": 1}`, http.StatusBadRequest},
+		{"POST", "/actions/move", `not json`, http.StatusBadRequest},
+		{"POST", "/actions/move", `{"label": "` + strings.Repeat("x", maxActionSize) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, request := range requests {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest(request.method, request.path, strings.NewReader(request.body)))
+		if w.Code != request.expected {
+			t.Errorf("%v %v %.50v returned %v, expected %v", request.method, request.path, request.body, w.Code, request.expected)
+		}
+	}
+	if len(c.jsonInChan) != 0 {
+		t.Fatal("invalid actions were sent")
+	}
+}
+
+func TestGatewayEvents(t *testing.T) {
+	c := newGatewayClient()
+	defer c.Close()
+	s := httptest.NewServer(NewGateway(c))
+	defer s.Close()
+
+	response, err := http.Get(s.URL + "/events/temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("unexpected response ", response.Status, response.Header)
+	}
+
+	c.dispatcher.dispatch(rotonde.Event{"temp", rotonde.Object{"value": 21.5}})
+	reader := bufio.NewReader(response.Body)
+	for _, expected := range []string{"event: temp\n", `data: {"value":21.5}` + "\n"} {
+		line, err := reader.ReadString('\n')
+		if err != nil || line != expected {
+			t.Fatalf("read %q, expected %q", line, expected)
+		}
+	}
+}
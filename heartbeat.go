@@ -0,0 +1,64 @@
+package client
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithHeartbeat pings rotonde every interval, the connection is considered
+// dead when nothing, pong or message, is received for interval plus
+// timeout. Writes taking longer than timeout also drop the connection. A
+// zero timeout defaults to interval.
+func WithHeartbeat(interval, timeout time.Duration) Option {
+	if timeout <= 0 {
+		timeout = interval
+	}
+	return func(c *Client) {
+		c.heartbeatInterval = interval
+		c.heartbeatTimeout = timeout
+	}
+}
+
+// extendReadDeadline is called each time something is received.
+func (c *Client) extendReadDeadline(conn *websocket.Conn) {
+	if c.heartbeatInterval <= 0 {
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(c.heartbeatInterval + c.heartbeatTimeout))
+}
+
+func (c *Client) setWriteDeadline(conn *websocket.Conn) {
+	if c.heartbeatTimeout <= 0 {
+		return
+	}
+	conn.SetWriteDeadline(time.Now().Add(c.heartbeatTimeout))
+}
+
+func (c *Client) startHeartbeat(conn *websocket.Conn, done chan bool, logger Logger) {
+	if c.heartbeatInterval <= 0 {
+		return
+	}
+	c.extendReadDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		c.extendReadDeadline(conn)
+		return nil
+	})
+
+	go func() {
+		ticker := time.NewTicker(c.heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.heartbeatTimeout)); err != nil {
+					logger.Warn("ping failed", Fields{"error": err})
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+}
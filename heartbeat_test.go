@@ -0,0 +1,51 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatWithoutTimeout(t *testing.T) {
+	f := newFakeRotonde(t)
+	defer f.close()
+
+	c := NewClient(f.url(), WithLogger(NopLogger()), WithHeartbeat(20*time.Millisecond, 0))
+	defer c.Close()
+	waitState(t, c, Connected)
+	time.Sleep(200 * time.Millisecond)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.conns) != 1 || c.State() != Connected {
+		t.Fatalf("%v connections, client is %v", len(f.conns), c.State())
+	}
+}
+
+func TestHeartbeatReconnects(t *testing.T) {
+	f := newFakeRotonde(t)
+	defer f.close()
+
+	interval, timeout := 50*time.Millisecond, 50*time.Millisecond
+	c := NewClient(f.url(), WithLogger(NopLogger()), WithHeartbeat(interval, timeout))
+	defer c.Close()
+	waitState(t, c, Connected)
+	time.Sleep(2 * interval)
+
+	f.mutex.Lock()
+	f.silent = true
+	f.mutex.Unlock()
+	start := time.Now()
+	for {
+		f.mutex.Lock()
+		conns := len(f.conns)
+		f.mutex.Unlock()
+		if conns > 1 {
+			break
+		}
+		// a little slack over interval plus timeout for the scheduler
+		if time.Since(start) > interval+timeout+100*time.Millisecond {
+			t.Fatal("no reconnection ", time.Since(start), " after the server went silent")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// HistoryOptions bounds the events retained for an identifier, by count
+// and/or by age. With Replay, handlers attached with OnNamedEvent first
+// receive the latest retained event.
+type HistoryOptions struct {
+	Size   int
+	MaxAge time.Duration
+	Replay bool
+}
+
+type HistoryEntry struct {
+	Time  time.Time
+	Event rotonde.Event
+}
+
+type history struct {
+	options HistoryOptions
+	entries []HistoryEntry
+}
+
+func (h *history) trim(now time.Time) {
+	drop := 0
+	if h.options.Size > 0 && len(h.entries) > h.options.Size {
+		drop = len(h.entries) - h.options.Size
+	}
+	if h.options.MaxAge > 0 {
+		for drop < len(h.entries) && now.Sub(h.entries[drop].Time) > h.options.MaxAge {
+			drop++
+		}
+	}
+	h.entries = h.entries[drop:]
+}
+
+// EnableHistory starts retaining the events of identifier, which is
+// subscribed to even if no handler is attached.
+func (c *Client) EnableHistory(identifier string, options HistoryOptions) {
+	if options.Size <= 0 && options.MaxAge <= 0 {
+		options.Size = 1
+	}
+	c.historyMutex.Lock()
+	h, ok := c.histories[identifier]
+	if ok {
+		h.options = options
+		h.trim(time.Now())
+		c.historyMutex.Unlock()
+		return
+	}
+	c.histories[identifier] = &history{options: options}
+	c.historyMutex.Unlock()
+	c.subscribe(identifier)
+}
+
+func (c *Client) DisableHistory(identifier string) {
+	c.historyMutex.Lock()
+	_, ok := c.histories[identifier]
+	delete(c.histories, identifier)
+	c.historyMutex.Unlock()
+	if ok {
+		c.unsubscribe(identifier)
+	}
+}
+
+func (c *Client) recordHistory(event rotonde.Event) {
+	c.historyMutex.Lock()
+	defer c.historyMutex.Unlock()
+	h, ok := c.histories[event.Identifier]
+	if ok == false {
+		return
+	}
+	now := time.Now()
+	h.entries = append(h.entries, HistoryEntry{now, event})
+	h.trim(now)
+}
+
+func (c *Client) LastEvent(identifier string) (rotonde.Event, bool) {
+	c.historyMutex.Lock()
+	defer c.historyMutex.Unlock()
+	h, ok := c.histories[identifier]
+	if ok == false {
+		return rotonde.Event{}, false
+	}
+	h.trim(time.Now())
+	if len(h.entries) == 0 {
+		return rotonde.Event{}, false
+	}
+	return h.entries[len(h.entries)-1].Event, true
+}
+
+// History returns the retained events of identifier received after since,
+// oldest first.
+func (c *Client) History(identifier string, since time.Time) []HistoryEntry {
+	c.historyMutex.Lock()
+	defer c.historyMutex.Unlock()
+	h, ok := c.histories[identifier]
+	if ok == false {
+		return nil
+	}
+	h.trim(time.Now())
+	result := make([]HistoryEntry, 0, len(h.entries))
+	for _, entry := range h.entries {
+		if entry.Time.After(since) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// replayHistory returns the event a new handler of identifier should
+// receive first, if any.
+func (c *Client) replayHistory(identifier string) (rotonde.Event, bool) {
+	c.historyMutex.Lock()
+	h, ok := c.histories[identifier]
+	replay := ok && h.options.Replay
+	c.historyMutex.Unlock()
+	if replay == false {
+		return rotonde.Event{}, false
+	}
+	return c.LastEvent(identifier)
+}
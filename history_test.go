@@ -0,0 +1,40 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func TestHistoryReplayBeforeLiveEvents(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:1/", WithLogger(NopLogger()))
+	defer c.Close()
+	c.EnableHistory("temp", HistoryOptions{Size: 1, Replay: true})
+	c.dispatcher.dispatch(rotonde.Event{"temp", rotonde.Object{"n": 0.0}})
+	time.Sleep(20 * time.Millisecond)
+
+	go func() {
+		for i := 1; i <= 50; i++ {
+			c.dispatcher.dispatch(rotonde.Event{"temp", rotonde.Object{"n": float64(i)}})
+		}
+	}()
+	received := make(chan float64, 100)
+	c.OnNamedEvent("temp", func(m interface{}) bool {
+		received <- m.(rotonde.Event).Data["n"].(float64)
+		return true
+	})
+
+	last := -1.0
+	for last < 50 {
+		select {
+		case n := <-received:
+			if n <= last {
+				t.Fatalf("received %v after %v", n, last)
+			}
+			last = n
+		case <-time.After(time.Second):
+			t.Fatalf("last event received is %v", last)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// Interceptor sees every packet going through the client, Payload being
+// the decoded message (rotonde.Event, rotonde.Definition...). It can modify
+// the packet in place, drop it by returning false, or inject new packets
+// which go through the rest of the chain.
+type Interceptor func(packet *rotonde.Packet, inject func(rotonde.Packet)) bool
+
+func packetType(message interface{}) string {
+	switch message.(type) {
+	case rotonde.Event:
+		return "event"
+	case rotonde.Action:
+		return "action"
+	case rotonde.Definition:
+		return "def"
+	case rotonde.UnDefinition:
+		return "undef"
+	case rotonde.Subscription:
+		return "sub"
+	case rotonde.Unsubscription:
+		return "unsub"
+	}
+	return ""
+}
+
+// AddInboundInterceptor appends fn to the chain run on received packets,
+// before they reach the handlers.
+func (c *Client) AddInboundInterceptor(fn Interceptor) {
+	c.interceptorMutex.Lock()
+	defer c.interceptorMutex.Unlock()
+	c.inboundInterceptors = append(c.inboundInterceptors[:len(c.inboundInterceptors):len(c.inboundInterceptors)], fn)
+}
+
+// AddOutboundInterceptor appends fn to the chain run on packets before
+// they are sent.
+func (c *Client) AddOutboundInterceptor(fn Interceptor) {
+	c.interceptorMutex.Lock()
+	defer c.interceptorMutex.Unlock()
+	c.outboundInterceptors = append(c.outboundInterceptors[:len(c.outboundInterceptors):len(c.outboundInterceptors)], fn)
+}
+
+// OnUnknownPacket registers fn to receive the raw frames this client
+// cannot decode, messageType being websocket.TextMessage or BinaryMessage.
+func (c *Client) OnUnknownPacket(fn func(messageType int, data []byte)) {
+	c.interceptorMutex.Lock()
+	defer c.interceptorMutex.Unlock()
+	c.unknownPacketHandlers = append(c.unknownPacketHandlers[:len(c.unknownPacketHandlers):len(c.unknownPacketHandlers)], fn)
+}
+
+func (c *Client) interceptors() (inbound, outbound []Interceptor, unknown []func(int, []byte)) {
+	c.interceptorMutex.Lock()
+	defer c.interceptorMutex.Unlock()
+	return c.inboundInterceptors, c.outboundInterceptors, c.unknownPacketHandlers
+}
+
+// intercept runs message through chain, emit receives the payloads of the
+// packets surviving the chain.
+func intercept(chain []Interceptor, message interface{}, emit func(interface{})) {
+	if len(chain) == 0 {
+		emit(message)
+		return
+	}
+	runInterceptors(chain, rotonde.Packet{Type: packetType(message), Payload: message}, emit)
+}
+
+func runInterceptors(chain []Interceptor, packet rotonde.Packet, emit func(interface{})) {
+	for i, fn := range chain {
+		rest := chain[i+1:]
+		inject := func(p rotonde.Packet) {
+			runInterceptors(rest, p, emit)
+		}
+		if fn(&packet, inject) == false {
+			return
+		}
+	}
+	emit(packet.Payload)
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+	"github.com/gorilla/websocket"
+)
+
+func writeFrame(t *testing.T, f *fakeRotonde, packet interface{}) {
+	data, err := JSONCodec.Encode(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInboundInterceptor(t *testing.T) {
+	f := newFakeRotonde(t)
+	defer f.close()
+	c := NewClient(f.url(), WithLogger(NopLogger()))
+	defer c.Close()
+
+	c.AddInboundInterceptor(func(packet *rotonde.Packet, inject func(rotonde.Packet)) bool {
+		event, ok := packet.Payload.(rotonde.Event)
+		if ok == false {
+			return true
+		}
+		if event.Identifier == "secret" {
+			return false
+		}
+		inject(rotonde.Packet{Type: "event", Payload: rotonde.Event{"copy", event.Data}})
+		packet.Payload = rotonde.Event{event.Identifier, rotonde.Object{"value": 2 * valueOf(event.Data)}}
+		return true
+	})
+	received := make(chan rotonde.Event, 10)
+	for _, identifier := range []string{"temp", "copy", "secret"} {
+		c.OnNamedEvent(identifier, func(m interface{}) bool {
+			received <- m.(rotonde.Event)
+			return true
+		})
+	}
+	waitState(t, c, Connected)
+
+	writeFrame(t, f, rotonde.Event{"secret", rotonde.Object{"value": 0.0}})
+	writeFrame(t, f, rotonde.Event{"temp", rotonde.Object{"value": 1.0}})
+	// handlers of different identifiers are not ordered
+	values := map[string]float64{}
+	for len(values) < 2 {
+		select {
+		case event := <-received:
+			values[event.Identifier] = valueOf(event.Data)
+		case <-time.After(2 * time.Second):
+			t.Fatal("received ", values)
+		}
+	}
+	if values["copy"] != 1 || values["temp"] != 2 {
+		t.Fatal("received ", values)
+	}
+	select {
+	case event := <-received:
+		t.Fatal("unexpected event ", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestOutboundInterceptor(t *testing.T) {
+	f := newFakeRotonde(t)
+	defer f.close()
+	c := NewClient(f.url(), WithLogger(NopLogger()))
+	defer c.Close()
+
+	c.AddOutboundInterceptor(func(packet *rotonde.Packet, inject func(rotonde.Packet)) bool {
+		action, ok := packet.Payload.(rotonde.Action)
+		if ok == false {
+			return true
+		}
+		if action.Identifier == "forbidden" {
+			return false
+		}
+		inject(rotonde.Packet{Type: "event", Payload: rotonde.Event{"audit", rotonde.Object{"action": action.Identifier}}})
+		return true
+	})
+	waitState(t, c, Connected)
+	c.SendAction("forbidden", rotonde.Object{})
+	c.SendAction("move", rotonde.Object{})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		identifiers := []string{}
+		for _, packet := range f.packets() {
+			switch p := packet.(type) {
+			case rotonde.Action:
+				identifiers = append(identifiers, p.Identifier)
+			case rotonde.Event:
+				identifiers = append(identifiers, p.Identifier)
+			}
+		}
+		if len(identifiers) == 2 {
+			if identifiers[0] != "audit" || identifiers[1] != "move" {
+				t.Fatal("sent ", identifiers, ", expected [audit move]")
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("sent ", f.packets())
+}
+
+func TestOnUnknownPacket(t *testing.T) {
+	f := newFakeRotonde(t)
+	defer f.close()
+	c := NewClient(f.url(), WithLogger(NopLogger()))
+	defer c.Close()
+
+	type frame struct {
+		messageType int
+		data        string
+	}
+	frames := make(chan frame, 10)
+	c.OnUnknownPacket(func(messageType int, data []byte) {
+		frames <- frame{messageType, string(data)}
+	})
+	received := make(chan rotonde.Event, 10)
+	c.OnNamedEvent("temp", func(m interface{}) bool {
+		received <- m.(rotonde.Event)
+		return true
+	})
+	waitState(t, c, Connected)
+
+	unknown := `{"type": "custom", "payload": {}}`
+	if err := f.write([]byte(unknown)); err != nil {
+		t.Fatal(err)
+	}
+	writeFrame(t, f, rotonde.Event{"temp", rotonde.Object{"value": 1.0}})
+	select {
+	case fr := <-frames:
+		if fr.messageType != websocket.TextMessage || fr.data != unknown {
+			t.Fatal("unexpected frame ", fr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("unknown packet not reported")
+	}
+	// the connection keeps working
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event after the unknown packet not received")
+	}
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// Jobs are long running actions. The action starting a job carries its id
+// in the JobIDHeader header, the handler reports on the <identifier>_progress
+// and <identifier>_done events, and the <identifier>_cancel action aborts it.
+
+const JobIDHeader = "job-id"
+
+func JobProgressIdentifier(identifier string) string {
+	return identifier + "_progress"
+}
+
+func JobDoneIdentifier(identifier string) string {
+	return identifier + "_done"
+}
+
+func JobCancelIdentifier(identifier string) string {
+	return identifier + "_cancel"
+}
+
+type JobProgress struct {
+	Progress float64
+	Message  string
+}
+
+// ProgressFunc reports the progress of a job, usually between 0 and 1.
+type ProgressFunc func(progress float64, message string)
+
+// JobHandlerFunc runs a job, ctx is canceled when the caller cancels the
+// job or when the client is closed. The returned error is sent to the caller.
+type JobHandlerFunc func(ctx context.Context, action rotonde.Action, progress ProgressFunc) error
+
+// OnNamedJob runs fn in its own goroutine for every job started on
+// identifier, and declares the progress and done events and the cancel
+// action of identifier.
+func (c *Client) OnNamedJob(identifier string, fn JobHandlerFunc) {
+	c.AddLocalDefinition(&rotonde.Definition{JobProgressIdentifier(identifier), "event", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"job_id", "string", ""},
+		&rotonde.FieldDefinition{"progress", "number", ""},
+		&rotonde.FieldDefinition{"message", "string", ""},
+	}})
+	c.AddLocalDefinition(&rotonde.Definition{JobDoneIdentifier(identifier), "event", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"job_id", "string", ""},
+		&rotonde.FieldDefinition{"error", "string", ""},
+	}})
+	c.AddLocalDefinition(&rotonde.Definition{JobCancelIdentifier(identifier), "action", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"job_id", "string", ""},
+	}})
+
+	running := make(map[string]context.CancelFunc)
+	c.OnNamedAction(JobCancelIdentifier(identifier), func(m interface{}) bool {
+		jobID, _ := m.(rotonde.Action).Data["job_id"].(string)
+		c.jobMutex.Lock()
+		if cancel, ok := running[jobID]; ok {
+			cancel()
+		}
+		c.jobMutex.Unlock()
+		return true
+	})
+
+	c.OnNamedAction(identifier, func(m interface{}) bool {
+		action := m.(rotonde.Action)
+		metadata, _ := ActionMetadata(action)
+		jobID := metadata.Headers[JobIDHeader]
+		if jobID == "" {
+			c.logger.Warn("job started without job id", Fields{"identifier": identifier})
+			return true
+		}
+
+		c.jobMutex.Lock()
+		if _, ok := running[jobID]; ok {
+			c.jobMutex.Unlock()
+			return true
+		}
+		ctx, cancel := context.WithCancel(c.ctx)
+		running[jobID] = cancel
+		c.jobMutex.Unlock()
+
+		go func() {
+			defer func() {
+				c.jobMutex.Lock()
+				delete(running, jobID)
+				c.jobMutex.Unlock()
+				cancel()
+			}()
+
+			ctx, span := c.startHandlerSpan(ctx, identifier, action.Data)
+			err := fn(ctx, action, func(progress float64, message string) {
+				c.SendEventContext(ctx, JobProgressIdentifier(identifier), rotonde.Object{"job_id": jobID, "progress": progress, "message": message})
+			})
+			span.End()
+
+			errorMessage := ""
+			if err != nil {
+				errorMessage = err.Error()
+			}
+			c.SendEventContext(ctx, JobDoneIdentifier(identifier), rotonde.Object{"job_id": jobID, "error": errorMessage})
+		}()
+		return true
+	})
+}
+
+// Job is the caller side of a job started with StartJob.
+type Job struct {
+	ID         string
+	c          *Client
+	identifier string
+	progress   chan JobProgress
+	done       chan bool
+	err        error
+}
+
+// StartJob sends the action starting a job on identifier, ctx only
+// provides the trace context.
+func (c *Client) StartJob(ctx context.Context, identifier string, data rotonde.Object) *Job {
+	j := &Job{ID: newMessageID(), c: c, identifier: identifier, progress: make(chan JobProgress, 10), done: make(chan bool)}
+	c.trackJob(j)
+	c.sendAction(ctx, identifier, data, map[string]string{JobIDHeader: j.ID})
+	return j
+}
+
+// Progress returns the reports of the job, reports are dropped when the
+// channel is full. It is closed when the job is done.
+func (j *Job) Progress() <-chan JobProgress {
+	return j.progress
+}
+
+// Cancel asks the handler to abort the job, Wait still returns when the
+// handler is done.
+func (j *Job) Cancel() {
+	j.c.SendAction(JobCancelIdentifier(j.identifier), rotonde.Object{"job_id": j.ID})
+}
+
+// Wait returns the error of the job once it is done. When ctx is done
+// first, the job is canceled and forgotten, Wait then returns the error of
+// ctx and so do the next calls.
+func (j *Job) Wait(ctx context.Context) error {
+	select {
+	case <-j.done:
+		return j.err
+	case <-ctx.Done():
+	}
+	if j.c.finishJob(j.ID, ctx.Err()) {
+		j.Cancel()
+	}
+	<-j.done
+	return j.err
+}
+
+// finishJob releases a tracked job, it returns false when the job is
+// already done.
+func (c *Client) finishJob(jobID string, err error) bool {
+	c.jobMutex.Lock()
+	defer c.jobMutex.Unlock()
+	j, ok := c.jobs[jobID]
+	if ok == false {
+		return false
+	}
+	j.err = err
+	delete(c.jobs, jobID)
+	close(j.progress)
+	close(j.done)
+	return true
+}
+
+func (c *Client) trackJob(j *Job) {
+	c.jobMutex.Lock()
+	c.jobs[j.ID] = j
+	listening := c.jobListeners[j.identifier]
+	c.jobListeners[j.identifier] = true
+	c.jobMutex.Unlock()
+
+	if listening {
+		return
+	}
+	// progress and done are handled by a single handler, named handlers of
+	// different identifiers could see the done event before the last
+	// progress reports.
+	progressIdentifier, doneIdentifier := JobProgressIdentifier(j.identifier), JobDoneIdentifier(j.identifier)
+	c.subscribe(progressIdentifier)
+	c.subscribe(doneIdentifier)
+	c.OnEvent(func(m interface{}) bool {
+		event := m.(rotonde.Event)
+		switch event.Identifier {
+		case progressIdentifier:
+			jobID, _ := event.Data["job_id"].(string)
+			progress, _ := toFloat(event.Data["progress"])
+			message, _ := event.Data["message"].(string)
+
+			c.jobMutex.Lock()
+			defer c.jobMutex.Unlock()
+			if j, ok := c.jobs[jobID]; ok {
+				select {
+				case j.progress <- JobProgress{progress, message}:
+				default:
+				}
+			}
+		case doneIdentifier:
+			jobID, _ := event.Data["job_id"].(string)
+			var err error
+			if message, _ := event.Data["error"].(string); message != "" {
+				err = errors.New(message)
+			}
+			c.finishJob(jobID, err)
+		}
+		return true
+	})
+}
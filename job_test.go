@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// loopback sends back to c the packets it writes, as if rotonde routed its
+// actions and events to itself.
+func loopback(t *testing.T, c *Client) {
+	go func() {
+		for packet := range c.jsonInChan {
+			switch p := packet.(type) {
+			case flushPacket:
+				close(p)
+				continue
+			case sessionPacket:
+				packet = p.packet
+			}
+			data, err := JSONCodec.Encode(packet)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if packet, err = JSONCodec.Decode(data); err != nil {
+				t.Error(err)
+				continue
+			}
+			c.dispatcher.dispatch(packet)
+		}
+	}()
+}
+
+func TestJob(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+	loopback(t, c)
+	c.OnNamedJob("move", func(ctx context.Context, action rotonde.Action, progress ProgressFunc) error {
+		for i := 0; i < 3; i++ {
+			progress(float64(i)/3, "moving")
+		}
+		return nil
+	})
+
+	j := c.StartJob(context.Background(), "move", nil)
+	reports := 0
+	for range j.Progress() {
+		reports++
+	}
+	if err := j.Wait(context.Background()); err != nil || reports != 3 {
+		t.Fatal("job returned ", err, " after ", reports, " reports")
+	}
+}
+
+func TestWaitReleasesJob(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+	loopback(t, c)
+	canceled := make(chan string, 1)
+	c.OnNamedAction(JobCancelIdentifier("move"), func(m interface{}) bool {
+		jobID, _ := m.(rotonde.Action).Data["job_id"].(string)
+		canceled <- jobID
+		return true
+	})
+
+	// nobody runs the job, it is never done
+	j := c.StartJob(context.Background(), "move", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := j.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatal("Wait returned ", err)
+	}
+	if err := j.Wait(context.Background()); err != context.DeadlineExceeded {
+		t.Fatal("second Wait returned ", err)
+	}
+	if _, ok := <-j.Progress(); ok {
+		t.Fatal("progress channel not closed")
+	}
+	c.jobMutex.Lock()
+	jobs := len(c.jobs)
+	c.jobMutex.Unlock()
+	if jobs != 0 {
+		t.Fatal(jobs, " jobs still tracked")
+	}
+
+	select {
+	case jobID := <-canceled:
+		if jobID != j.ID {
+			t.Fatal("canceled job ", jobID, ", expected ", j.ID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job not canceled")
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Sirupsen/logrus"
+)
+
+type Fields map[string]interface{}
+
+// Logger receives the logs of a client, each message comes with structured
+// fields: client name, connection ID and endpoint, or identifier.
+type Logger interface {
+	Debug(msg string, fields Fields)
+	Info(msg string, fields Fields)
+	Warn(msg string, fields Fields)
+	Error(msg string, fields Fields)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, Fields) {}
+func (nopLogger) Info(string, Fields)  {}
+func (nopLogger) Warn(string, Fields)  {}
+func (nopLogger) Error(string, Fields) {}
+
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// SlogLogger adapts a log/slog logger, nil means slog.Default().
+func SlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return slogLogger{l}
+}
+
+func (s slogLogger) log(level slog.Level, msg string, fields Fields) {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for key, value := range fields {
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	s.l.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+func (s slogLogger) Debug(msg string, fields Fields) { s.log(slog.LevelDebug, msg, fields) }
+func (s slogLogger) Info(msg string, fields Fields)  { s.log(slog.LevelInfo, msg, fields) }
+func (s slogLogger) Warn(msg string, fields Fields)  { s.log(slog.LevelWarn, msg, fields) }
+func (s slogLogger) Error(msg string, fields Fields) { s.log(slog.LevelError, msg, fields) }
+
+type logrusLogger struct {
+	l *logrus.Logger
+}
+
+// LogrusLogger adapts a logrus logger, nil means the standard logrus
+// logger, which is where the logs of the client used to go.
+func LogrusLogger(l *logrus.Logger) Logger {
+	if l == nil {
+		l = logrus.StandardLogger()
+	}
+	return logrusLogger{l}
+}
+
+func (l logrusLogger) entry(fields Fields) *logrus.Entry {
+	return l.l.WithFields(logrus.Fields(fields))
+}
+
+func (l logrusLogger) Debug(msg string, fields Fields) { l.entry(fields).Debug(msg) }
+func (l logrusLogger) Info(msg string, fields Fields)  { l.entry(fields).Info(msg) }
+func (l logrusLogger) Warn(msg string, fields Fields)  { l.entry(fields).Warn(msg) }
+func (l logrusLogger) Error(msg string, fields Fields) { l.entry(fields).Error(msg) }
+
+// fieldsLogger adds its fields to all the messages of a logger.
+type fieldsLogger struct {
+	l      Logger
+	fields Fields
+}
+
+func withFields(l Logger, fields Fields) Logger {
+	if f, ok := l.(fieldsLogger); ok {
+		l = f.l
+		fields = f.merge(fields)
+	}
+	return fieldsLogger{l, fields}
+}
+
+func (f fieldsLogger) merge(fields Fields) Fields {
+	merged := make(Fields, len(f.fields)+len(fields))
+	for key, value := range f.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return merged
+}
+
+func (f fieldsLogger) Debug(msg string, fields Fields) { f.l.Debug(msg, f.merge(fields)) }
+func (f fieldsLogger) Info(msg string, fields Fields)  { f.l.Info(msg, f.merge(fields)) }
+func (f fieldsLogger) Warn(msg string, fields Fields)  { f.l.Warn(msg, f.merge(fields)) }
+func (f fieldsLogger) Error(msg string, fields Fields) { f.l.Error(msg, f.merge(fields)) }
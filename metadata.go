@@ -0,0 +1,112 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// MetadataKey is the data key holding the metadata envelope of events and
+// actions, rotonde forwards it as any other field.
+const MetadataKey = "_meta"
+
+// Metadata describes the production of an event or action.
+type Metadata struct {
+	Module string
+	// Sequence is incremented for each message of an identifier sent by
+	// Module, a gap means messages were lost or throttled.
+	Sequence  uint64
+	Timestamp time.Time
+	Headers   map[string]string
+}
+
+// WithMetadata adds a metadata envelope to the events and actions sent by
+// the client, module identifies the sender and defaults to the client name.
+func WithMetadata(module string) Option {
+	return func(c *Client) {
+		c.metadata = true
+		c.moduleID = module
+	}
+}
+
+// attachMetadata returns a copy of data carrying the metadata envelope of
+// the client. When metadata is disabled and there are no headers to carry,
+// data is sent without envelope, a received one is not forwarded as is.
+func (c *Client) attachMetadata(kind, identifier string, data rotonde.Object, headers map[string]string) rotonde.Object {
+	if c.metadata == false && len(headers) == 0 {
+		if _, ok := data[MetadataKey]; ok {
+			return WithoutMetadata(data)
+		}
+		return data
+	}
+	module := c.moduleID
+	if module == "" {
+		module = c.name
+	}
+
+	c.sequenceMutex.Lock()
+	c.sequences[kind+"/"+identifier]++
+	sequence := c.sequences[kind+"/"+identifier]
+	c.sequenceMutex.Unlock()
+
+	meta := map[string]interface{}{
+		"module":    module,
+		"sequence":  sequence,
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if len(headers) > 0 {
+		h := make(map[string]interface{}, len(headers))
+		for key, value := range headers {
+			h[key] = value
+		}
+		meta["headers"] = h
+	}
+
+	withMeta := make(rotonde.Object, len(data)+1)
+	for key, value := range data {
+		withMeta[key] = value
+	}
+	withMeta[MetadataKey] = meta
+	return withMeta
+}
+
+// GetMetadata extracts the metadata envelope from the data of an event or
+// action, ok is false when the sender did not enable metadata.
+func GetMetadata(data rotonde.Object) (metadata Metadata, ok bool) {
+	meta, ok := data[MetadataKey].(map[string]interface{})
+	if ok == false {
+		return metadata, false
+	}
+	metadata.Module, _ = meta["module"].(string)
+	if sequence, isNumber := toFloat(meta["sequence"]); isNumber {
+		metadata.Sequence = uint64(sequence)
+	}
+	if timestamp, isString := meta["timestamp"].(string); isString {
+		metadata.Timestamp, _ = time.Parse(time.RFC3339Nano, timestamp)
+	}
+	if headers, isMap := meta["headers"].(map[string]interface{}); isMap {
+		metadata.Headers = make(map[string]string, len(headers))
+		for key, value := range headers {
+			metadata.Headers[key] = fmt.Sprint(value)
+		}
+	}
+	return metadata, true
+}
+
+// WithoutMetadata returns a copy of data without its metadata envelope.
+func WithoutMetadata(data rotonde.Object) rotonde.Object {
+	copied := copyObject(data)
+	delete(copied, MetadataKey)
+	return copied
+}
+
+// EventMetadata returns the metadata envelope of event.
+func EventMetadata(event rotonde.Event) (Metadata, bool) {
+	return GetMetadata(event.Data)
+}
+
+// ActionMetadata returns the metadata envelope of action.
+func ActionMetadata(action rotonde.Action) (Metadata, bool) {
+	return GetMetadata(action.Data)
+}
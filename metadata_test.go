@@ -0,0 +1,57 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func TestMetadataEnvelope(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()), WithName("thermostat"), WithMetadata(""))
+	defer c.Close()
+
+	received := rotonde.Object{"value": 1.0, MetadataKey: map[string]interface{}{"module": "sensor", "sequence": 7.0}}
+	data := c.attachMetadata("event", "temp", received, map[string]string{"traceparent": "00-x"})
+	data = c.attachMetadata("event", "temp", data, nil)
+	metadata, ok := GetMetadata(data)
+	if ok == false || metadata.Module != "thermostat" || metadata.Sequence != 2 || len(metadata.Headers) != 0 {
+		t.Fatal("unexpected metadata ", metadata)
+	}
+	if time.Since(metadata.Timestamp) > time.Minute {
+		t.Fatal("unexpected timestamp ", metadata.Timestamp)
+	}
+	if _, ok := GetMetadata(received); ok == false || received[MetadataKey].(map[string]interface{})["module"] != "sensor" {
+		t.Fatal("the received data was modified")
+	}
+}
+
+func TestReceivedMetadataIsNotForwarded(t *testing.T) {
+	f := newFakeRotonde(t)
+	defer f.close()
+
+	c := NewClient(f.url(), WithLogger(NopLogger()))
+	defer c.Close()
+	waitState(t, c, Connected)
+	received := rotonde.Object{"value": 1.0, MetadataKey: map[string]interface{}{"module": "sensor"}}
+	c.SendEvent("derived", received)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, packet := range f.packets() {
+			event, ok := packet.(rotonde.Event)
+			if ok == false {
+				continue
+			}
+			if _, ok := event.Data[MetadataKey]; ok || event.Data["value"] != 1.0 {
+				t.Fatal("unexpected event data ", event.Data)
+			}
+			if _, ok := received[MetadataKey]; ok == false {
+				t.Fatal("the received data was modified")
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("event not received")
+}
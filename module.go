@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+type ActionSpec struct {
+	Identifier string
+	IsArray    bool
+	Fields     rotonde.FieldDefinitions
+	Policy     ActionPolicy
+	Handler    ActionHandlerFunc
+}
+
+type EventSpec struct {
+	Identifier string
+	IsArray    bool
+	Fields     rotonde.FieldDefinitions
+}
+
+// Module declares a rotonde service, its actions with their handlers and
+// the events it sends. Run takes care of the connection and of the
+// definitions, which are registered again after each reconnection. Modules
+// are created with NewModule.
+type Module struct {
+	URL     string
+	Options []Option
+	Actions []ActionSpec
+	Events  []EventSpec
+
+	mutex  *sync.Mutex
+	client *Client
+}
+
+func NewModule(url string, options ...Option) *Module {
+	return &Module{URL: url, Options: options, mutex: &sync.Mutex{}}
+}
+
+func (m *Module) validate() error {
+	identifiers := make(map[string]bool)
+	for _, action := range m.Actions {
+		if action.Handler == nil {
+			return errors.New(fmt.Sprint(action.Identifier, " has no handler"))
+		}
+		if identifiers["action "+action.Identifier] {
+			return errors.New(fmt.Sprint(action.Identifier, " declared twice"))
+		}
+		identifiers["action "+action.Identifier] = true
+	}
+	for _, event := range m.Events {
+		if identifiers["event "+event.Identifier] {
+			return errors.New(fmt.Sprint(event.Identifier, " declared twice"))
+		}
+		identifiers["event "+event.Identifier] = true
+	}
+	return nil
+}
+
+// Run blocks until ctx is done, the module's definitions are then removed
+// and the client closed.
+func (m *Module) Run(ctx context.Context) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	if m.client != nil {
+		m.mutex.Unlock()
+		return errors.New("module already running")
+	}
+	c := NewClient(m.URL, m.Options...)
+	m.client = c
+	m.mutex.Unlock()
+
+	for _, action := range m.Actions {
+		c.AddLocalDefinition(&rotonde.Definition{action.Identifier, "action", action.IsArray, action.Fields})
+		c.OnNamedActionWithPolicy(action.Identifier, action.Policy, action.Handler)
+	}
+	for _, event := range m.Events {
+		c.AddLocalDefinition(&rotonde.Definition{event.Identifier, "event", event.IsArray, event.Fields})
+	}
+
+	<-ctx.Done()
+
+	for _, action := range m.Actions {
+		c.RemoveLocalDefinition("action", action.Identifier)
+	}
+	for _, event := range m.Events {
+		c.RemoveLocalDefinition("event", event.Identifier)
+	}
+	c.Close()
+
+	m.mutex.Lock()
+	m.client = nil
+	m.mutex.Unlock()
+	return nil
+}
+
+// Client returns the client of the running module, nil if it is not running.
+func (m *Module) Client() *Client {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.client
+}
+
+func (m *Module) SendEvent(identifier string, data rotonde.Object) error {
+	declared := false
+	for _, event := range m.Events {
+		if event.Identifier == identifier {
+			declared = true
+			break
+		}
+	}
+	if declared == false {
+		return errors.New(fmt.Sprint(identifier, " is not a declared event"))
+	}
+	c := m.Client()
+	if c == nil {
+		return errors.New("module not running")
+	}
+	c.SendEvent(identifier, data)
+	return nil
+}
@@ -0,0 +1,217 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/HackerLoop/rotonde-client.go"
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// Broker is the part of an MQTT client used by the bridge, any MQTT
+// library can be adapted to it.
+type Broker interface {
+	Publish(topic string, qos byte, retained bool, payload []byte) error
+	Subscribe(topic string, qos byte, handler func(topic string, payload []byte)) error
+	Unsubscribe(topic string) error
+}
+
+// Config describes the mapping between rotonde and MQTT. Topic templates
+// can contain {identifier} and, for definitions, {type}.
+type Config struct {
+	EventTopic      string
+	ActionTopic     string
+	DefinitionTopic string
+	QoS             byte
+
+	// Events lists the patterns of the events published to MQTT, as
+	// matched by client.MatchPattern: * stays within a segment of the
+	// identifier, ** matches any number of segments.
+	Events []string
+	// Actions lists the patterns of the actions accepted from MQTT, all of
+	// them when empty.
+	Actions []string
+}
+
+var DefaultConfig = Config{
+	EventTopic:      "rotonde/events/{identifier}",
+	ActionTopic:     "rotonde/actions/{identifier}",
+	DefinitionTopic: "rotonde/definitions/{type}/{identifier}",
+	Events:          []string{"**"},
+}
+
+type Bridge struct {
+	c      *client.Client
+	broker Broker
+	config Config
+
+	mutex   *sync.Mutex
+	running bool
+	cancels []func()
+}
+
+func NewBridge(c *client.Client, broker Broker, config Config) *Bridge {
+	if config.EventTopic == "" {
+		config.EventTopic = DefaultConfig.EventTopic
+	}
+	if config.ActionTopic == "" {
+		config.ActionTopic = DefaultConfig.ActionTopic
+	}
+	if config.DefinitionTopic == "" {
+		config.DefinitionTopic = DefaultConfig.DefinitionTopic
+	}
+	return &Bridge{c: c, broker: broker, config: config, mutex: &sync.Mutex{}}
+}
+
+func expand(template string, typ string, identifier string) string {
+	return strings.NewReplacer("{type}", typ, "{identifier}", identifier).Replace(template)
+}
+
+// subscriptionTopic turns a topic template into an MQTT subscription, and
+// returns the function extracting the identifier from received topics.
+func subscriptionTopic(template string) (string, func(string) (string, bool), error) {
+	i := strings.Index(template, "{identifier}")
+	if i < 0 {
+		return "", nil, errors.New("topic template without {identifier}: " + template)
+	}
+	prefix, suffix := template[:i], template[i+len("{identifier}"):]
+	wildcard := "+"
+	if suffix == "" {
+		wildcard = "#"
+	}
+	extract := func(topic string) (string, bool) {
+		if strings.HasPrefix(topic, prefix) == false || strings.HasSuffix(topic, suffix) == false || len(topic) <= len(prefix)+len(suffix) {
+			return "", false
+		}
+		return topic[len(prefix) : len(topic)-len(suffix)], true
+	}
+	return prefix + wildcard + suffix, extract, nil
+}
+
+func (b *Bridge) active() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.running
+}
+
+func (b *Bridge) Start() error {
+	b.mutex.Lock()
+	if b.running {
+		b.mutex.Unlock()
+		return errors.New("bridge already started")
+	}
+	b.running = true
+	b.mutex.Unlock()
+
+	for _, pattern := range b.config.Actions {
+		if err := client.ValidatePattern(pattern); err != nil {
+			b.Stop()
+			return err
+		}
+	}
+
+	topic, extract, err := subscriptionTopic(b.config.ActionTopic)
+	if err != nil {
+		b.Stop()
+		return err
+	}
+	if err := b.broker.Subscribe(topic, b.config.QoS, func(topic string, payload []byte) {
+		identifier, ok := extract(topic)
+		if ok == false || b.acceptAction(identifier) == false {
+			return
+		}
+		data := rotonde.Object{}
+		if err := json.Unmarshal(payload, &data); err != nil {
+			b.c.Logger().Warn("invalid action payload", client.Fields{"topic": topic, "error": err})
+			return
+		}
+		b.c.SendAction(identifier, data)
+	}); err != nil {
+		b.Stop()
+		return err
+	}
+	b.addCancel(func() {
+		b.broker.Unsubscribe(topic)
+	})
+
+	for _, pattern := range b.config.Events {
+		cancel, err := b.c.OnEventPattern(pattern, func(m interface{}) bool {
+			event := m.(rotonde.Event)
+			b.publish(expand(b.config.EventTopic, "event", event.Identifier), false, client.WithoutMetadata(event.Data))
+			return true
+		})
+		if err != nil {
+			b.Stop()
+			return err
+		}
+		b.addCancel(cancel)
+	}
+
+	b.addCancel(b.c.AttachDefinition(func(m interface{}) bool {
+		if b.active() == false {
+			return false
+		}
+		definition := m.(rotonde.Definition)
+		b.publishDefinition(&definition)
+		return true
+	}))
+	b.addCancel(b.c.AttachUnDefinition(func(m interface{}) bool {
+		if b.active() == false {
+			return false
+		}
+		definition := m.(rotonde.UnDefinition)
+		b.broker.Publish(expand(b.config.DefinitionTopic, definition.Type, definition.Identifier), b.config.QoS, true, []byte{})
+		return true
+	}))
+	for _, definition := range b.c.GetRemoteDefinitions("") {
+		b.publishDefinition(definition)
+	}
+	return nil
+}
+
+func (b *Bridge) Stop() {
+	b.mutex.Lock()
+	b.running = false
+	cancels := b.cancels
+	b.cancels = nil
+	b.mutex.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+func (b *Bridge) addCancel(cancel func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.cancels = append(b.cancels, cancel)
+}
+
+func (b *Bridge) acceptAction(identifier string) bool {
+	if len(b.config.Actions) == 0 {
+		return true
+	}
+	for _, pattern := range b.config.Actions {
+		if client.MatchPattern(pattern, identifier) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bridge) publishDefinition(definition *rotonde.Definition) {
+	b.publish(expand(b.config.DefinitionTopic, definition.Type, definition.Identifier), true, definition)
+}
+
+func (b *Bridge) publish(topic string, retained bool, v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		b.c.Logger().Warn("cannot encode payload", client.Fields{"topic": topic, "error": err})
+		return
+	}
+	if err := b.broker.Publish(topic, b.config.QoS, retained, payload); err != nil {
+		b.c.Logger().Warn("publish failed", client.Fields{"topic": topic, "error": err})
+	}
+}
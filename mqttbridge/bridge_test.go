@@ -0,0 +1,229 @@
+package mqttbridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde-client.go"
+	"github.com/HackerLoop/rotonde/shared"
+	"github.com/gorilla/websocket"
+)
+
+// fakeRotonde is a websocket server recording the packets it receives, and
+// sending packets to the connected client.
+type fakeRotonde struct {
+	server *httptest.Server
+
+	mutex    *sync.Mutex
+	conn     *websocket.Conn
+	received []interface{}
+}
+
+func newFakeRotonde(t *testing.T) *fakeRotonde {
+	f := &fakeRotonde{mutex: &sync.Mutex{}}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f.mutex.Lock()
+		f.conn = conn
+		f.mutex.Unlock()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			packet, err := rotonde.FromJSON(bytes.NewReader(data))
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			f.mutex.Lock()
+			f.received = append(f.received, packet)
+			f.mutex.Unlock()
+		}
+	}))
+	return f
+}
+
+func (f *fakeRotonde) url() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+func (f *fakeRotonde) send(t *testing.T, packet interface{}) {
+	data, err := rotonde.ToJSON(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitReceived returns the first received packet accepted by match.
+func (f *fakeRotonde) waitReceived(t *testing.T, match func(interface{}) bool) interface{} {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mutex.Lock()
+		for _, packet := range f.received {
+			if match(packet) {
+				f.mutex.Unlock()
+				return packet
+			}
+		}
+		f.mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("packet not received")
+	return nil
+}
+
+func (f *fakeRotonde) close() {
+	f.mutex.Lock()
+	if f.conn != nil {
+		f.conn.Close()
+	}
+	f.mutex.Unlock()
+	f.server.Close()
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for condition() == false {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for ", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func startBridge(t *testing.T, config Config) (*fakeRotonde, *client.Client, *MemoryBroker, *Bridge) {
+	f := newFakeRotonde(t)
+	c := client.NewClient(f.url(), client.WithLogger(client.NopLogger()))
+	waitFor(t, "connection", func() bool {
+		return c.State() == client.Connected
+	})
+	broker := NewMemoryBroker()
+	b := NewBridge(c, broker, config)
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return f, c, broker, b
+}
+
+func TestEventTopics(t *testing.T) {
+	f, c, broker, b := startBridge(t, DefaultConfig)
+	defer f.close()
+	defer c.Close()
+	defer b.Stop()
+
+	published := make(chan string, 10)
+	broker.Subscribe("rotonde/events/#", 0, func(topic string, payload []byte) {
+		published <- topic + " " + string(payload)
+	})
+
+	f.send(t, rotonde.Definition{"sensor/kitchen/temp", "event", false, nil})
+	f.waitReceived(t, func(packet interface{}) bool {
+		subscription, ok := packet.(rotonde.Subscription)
+		return ok && subscription.Identifier == "sensor/kitchen/temp"
+	})
+	f.send(t, rotonde.Event{"sensor/kitchen/temp", rotonde.Object{
+		"value":            21.5,
+		client.MetadataKey: map[string]interface{}{"module": "sensor"},
+	}})
+
+	select {
+	case message := <-published:
+		if message != `rotonde/events/sensor/kitchen/temp {"value":21.5}` {
+			t.Fatal("unexpected message ", message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not published")
+	}
+}
+
+func TestRetainedDefinitions(t *testing.T) {
+	f, c, broker, b := startBridge(t, DefaultConfig)
+	defer f.close()
+	defer c.Close()
+	defer b.Stop()
+
+	topic := "rotonde/definitions/action/light/on"
+	f.send(t, rotonde.Definition{"light/on", "action", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"level", "number", ""},
+	}})
+	waitFor(t, "retained definition", func() bool {
+		return broker.Retained(topic) != nil
+	})
+	definition := rotonde.Definition{}
+	if err := json.Unmarshal(broker.Retained(topic), &definition); err != nil {
+		t.Fatal(err)
+	}
+	if definition.Identifier != "light/on" || len(definition.Fields) != 1 {
+		t.Fatal("unexpected definition ", definition)
+	}
+
+	f.send(t, rotonde.UnDefinition{"light/on", "action", false, nil})
+	waitFor(t, "cleared definition", func() bool {
+		return broker.Retained(topic) == nil
+	})
+}
+
+func TestActionsFromMQTT(t *testing.T) {
+	config := DefaultConfig
+	config.Actions = []string{"light/**"}
+	f, c, broker, b := startBridge(t, config)
+	defer f.close()
+	defer c.Close()
+	defer b.Stop()
+
+	broker.Publish("rotonde/actions/door/open", 0, false, []byte(`{}`))
+	broker.Publish("rotonde/actions/light/kitchen/on", 0, false, []byte(`{"level": 3}`))
+
+	packet := f.waitReceived(t, func(packet interface{}) bool {
+		_, ok := packet.(rotonde.Action)
+		return ok
+	})
+	action := packet.(rotonde.Action)
+	if action.Identifier != "light/kitchen/on" || action.Data["level"] != 3.0 {
+		t.Fatal("unexpected action ", action)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	f, c, broker, b := startBridge(t, DefaultConfig)
+	defer f.close()
+	defer c.Close()
+	defer b.Stop()
+
+	b.Stop()
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	published := make(chan string, 10)
+	broker.Subscribe("rotonde/definitions/#", 0, func(topic string, payload []byte) {
+		published <- topic
+	})
+	f.send(t, rotonde.Definition{"light/on", "action", false, nil})
+
+	select {
+	case <-published:
+	case <-time.After(2 * time.Second):
+		t.Fatal("definition not published")
+	}
+	select {
+	case topic := <-published:
+		t.Fatal(topic, " published twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,94 @@
+package mqttbridge
+
+import (
+	"strings"
+	"sync"
+)
+
+// MemoryBroker is an in-process stand-in for an MQTT broker, supporting the
+// + and # wildcards and retained messages. It is meant for tests and
+// development without a real broker.
+type MemoryBroker struct {
+	mutex         *sync.Mutex
+	subscriptions map[string]func(topic string, payload []byte)
+	retained      map[string][]byte
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		mutex:         &sync.Mutex{},
+		subscriptions: make(map[string]func(string, []byte)),
+		retained:      make(map[string][]byte),
+	}
+}
+
+func (m *MemoryBroker) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	m.mutex.Lock()
+	if retained {
+		if len(payload) == 0 {
+			delete(m.retained, topic)
+		} else {
+			m.retained[topic] = payload
+		}
+	}
+	handlers := make([]func(string, []byte), 0, len(m.subscriptions))
+	for filter, handler := range m.subscriptions {
+		if matchTopic(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(topic, payload)
+	}
+	return nil
+}
+
+func (m *MemoryBroker) Subscribe(filter string, qos byte, handler func(topic string, payload []byte)) error {
+	m.mutex.Lock()
+	m.subscriptions[filter] = handler
+	retained := make(map[string][]byte)
+	for topic, payload := range m.retained {
+		if matchTopic(filter, topic) {
+			retained[topic] = payload
+		}
+	}
+	m.mutex.Unlock()
+
+	for topic, payload := range retained {
+		handler(topic, payload)
+	}
+	return nil
+}
+
+func (m *MemoryBroker) Unsubscribe(filter string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.subscriptions, filter)
+	return nil
+}
+
+// Retained returns the retained payload of topic, nil if there is none.
+func (m *MemoryBroker) Retained(topic string) []byte {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.retained[topic]
+}
+
+func matchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MessagePack encoding of the generic values produced by binaryCodec.
+
+func encodeMessagePack(buffer *bytes.Buffer, value interface{}) error {
+	value, err := genericValue(value)
+	if err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		buffer.WriteByte(0xc0)
+	case bool:
+		if v {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+	case int64:
+		switch {
+		case v >= 0 && v <= 0x7f:
+			buffer.WriteByte(byte(v))
+		case v < 0 && v >= -32:
+			buffer.WriteByte(byte(v))
+		default:
+			buffer.WriteByte(0xd3)
+			binary.Write(buffer, binary.BigEndian, v)
+		}
+	case float64:
+		buffer.WriteByte(0xcb)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(v))
+	case string:
+		n := len(v)
+		switch {
+		case n <= 31:
+			buffer.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buffer.WriteByte(0xd9)
+			buffer.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			buffer.WriteByte(0xda)
+			binary.Write(buffer, binary.BigEndian, uint16(n))
+		default:
+			buffer.WriteByte(0xdb)
+			binary.Write(buffer, binary.BigEndian, uint32(n))
+		}
+		buffer.WriteString(v)
+	case []interface{}:
+		n := len(v)
+		switch {
+		case n <= 15:
+			buffer.WriteByte(0x90 | byte(n))
+		case n <= math.MaxUint16:
+			buffer.WriteByte(0xdc)
+			binary.Write(buffer, binary.BigEndian, uint16(n))
+		default:
+			buffer.WriteByte(0xdd)
+			binary.Write(buffer, binary.BigEndian, uint32(n))
+		}
+		for _, item := range v {
+			if err := encodeMessagePack(buffer, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		n := len(v)
+		switch {
+		case n <= 15:
+			buffer.WriteByte(0x80 | byte(n))
+		case n <= math.MaxUint16:
+			buffer.WriteByte(0xde)
+			binary.Write(buffer, binary.BigEndian, uint16(n))
+		default:
+			buffer.WriteByte(0xdf)
+			binary.Write(buffer, binary.BigEndian, uint32(n))
+		}
+		for key, item := range v {
+			encodeMessagePack(buffer, key)
+			if err := encodeMessagePack(buffer, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New(fmt.Sprintf("msgpack: cannot encode %T", value))
+	}
+	return nil
+}
+
+var errTruncated = errors.New("truncated message")
+
+// readUint reads a big endian unsigned integer of size bytes.
+func readUint(data []byte, size int) (uint64, []byte, error) {
+	if len(data) < size {
+		return 0, nil, errTruncated
+	}
+	var n uint64
+	for _, b := range data[:size] {
+		n = n<<8 | uint64(b)
+	}
+	return n, data[size:], nil
+}
+
+func decodeMessagePack(data []byte) (interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errTruncated
+	}
+	t, data := data[0], data[1:]
+	switch {
+	case t <= 0x7f:
+		return int64(t), data, nil
+	case t >= 0xe0:
+		return int64(int8(t)), data, nil
+	case t&0xe0 == 0xa0:
+		return decodeMessagePackString(data, uint64(t&0x1f))
+	case t&0xf0 == 0x90:
+		return decodeMessagePackArray(data, uint64(t&0x0f))
+	case t&0xf0 == 0x80:
+		return decodeMessagePackMap(data, uint64(t&0x0f))
+	}
+
+	switch t {
+	case 0xc0:
+		return nil, data, nil
+	case 0xc2:
+		return false, data, nil
+	case 0xc3:
+		return true, data, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, rest, err := readUint(data, 1<<(t-0xcc))
+		if err != nil {
+			return nil, nil, err
+		}
+		if n > math.MaxInt64 {
+			return float64(n), rest, nil
+		}
+		return int64(n), rest, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (t - 0xd0)
+		n, rest, err := readUint(data, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		shift := uint(64 - 8*size)
+		return int64(n<<shift) >> shift, rest, nil
+	case 0xca:
+		n, rest, err := readUint(data, 4)
+		if err != nil {
+			return nil, nil, err
+		}
+		return float64(math.Float32frombits(uint32(n))), rest, nil
+	case 0xcb:
+		n, rest, err := readUint(data, 8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return math.Float64frombits(n), rest, nil
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		// str 8/16/32 and bin 8/16/32, binaries are decoded as strings
+		size := 1 << (t - 0xd9)
+		if t <= 0xc6 {
+			size = 1 << (t - 0xc4)
+		}
+		n, rest, err := readUint(data, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMessagePackString(rest, n)
+	case 0xdc, 0xdd:
+		n, rest, err := readUint(data, 2<<(t-0xdc))
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMessagePackArray(rest, n)
+	case 0xde, 0xdf:
+		n, rest, err := readUint(data, 2<<(t-0xde))
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMessagePackMap(rest, n)
+	}
+	return nil, nil, errors.New(fmt.Sprintf("msgpack: unsupported type 0x%x", t))
+}
+
+func decodeMessagePackString(data []byte, n uint64) (interface{}, []byte, error) {
+	if uint64(len(data)) < n {
+		return nil, nil, errTruncated
+	}
+	return string(data[:n]), data[n:], nil
+}
+
+func decodeMessagePackArray(data []byte, n uint64) (interface{}, []byte, error) {
+	if uint64(len(data)) < n {
+		return nil, nil, errTruncated
+	}
+	array := make([]interface{}, 0, n)
+	for i := uint64(0); i < n; i++ {
+		item, rest, err := decodeMessagePack(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		array = append(array, item)
+		data = rest
+	}
+	return array, data, nil
+}
+
+func decodeMessagePackMap(data []byte, n uint64) (interface{}, []byte, error) {
+	if uint64(len(data)) < 2*n {
+		return nil, nil, errTruncated
+	}
+	m := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		key, rest, err := decodeMessagePack(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, rest, err := decodeMessagePack(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		m[fmt.Sprint(key)] = value
+		data = rest
+	}
+	return m, data, nil
+}
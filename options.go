@@ -0,0 +1,18 @@
+package client
+
+// Option configures a client created with NewClient.
+type Option func(c *Client)
+
+// WithName names the client in its logs.
+func WithName(name string) Option {
+	return func(c *Client) {
+		c.name = name
+	}
+}
+
+// WithLogger replaces the default logger, which writes to slog.Default().
+func WithLogger(l Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+type patternSubscription struct {
+	c     *Client
+	match func(identifier string) bool
+	fn    HandlerFunc
+
+	mutex     *sync.Mutex
+	detaches  map[string]func()
+	cancelled bool
+	// detach the definition and undefinition handlers
+	unwatch []func()
+}
+
+// ValidatePattern checks the syntax of a pattern for MatchPattern.
+func ValidatePattern(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MatchPattern matches identifier against a glob pattern segment by
+// segment, segments being separated by /. Within a segment, the syntax is
+// the one of path.Match, so * never crosses a /: sensor/* matches
+// sensor/temp but not sensor/a/b. A ** segment matches any number of
+// segments: sensor/** matches both, and ** alone matches everything.
+func MatchPattern(pattern, identifier string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(identifier, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); ok == false {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// OnEventPattern attaches fn to all the events whose identifier matches the
+// glob pattern, as implemented by MatchPattern. Subscriptions are sent for
+// every matching event defined on rotonde, now or later. The returned
+// function cancels the handler and its subscriptions.
+func (c *Client) OnEventPattern(pattern string, fn HandlerFunc) (func(), error) {
+	if err := ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+	return c.onEventMatching(func(identifier string) bool {
+		return MatchPattern(pattern, identifier)
+	}, fn), nil
+}
+
+// OnEventRegexp is OnEventPattern with a regular expression.
+func (c *Client) OnEventRegexp(expr string, fn HandlerFunc) (func(), error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return c.onEventMatching(re.MatchString, fn), nil
+}
+
+func (c *Client) onEventMatching(match func(string) bool, fn HandlerFunc) func() {
+	s := &patternSubscription{c: c, match: match, fn: fn, mutex: &sync.Mutex{}, detaches: make(map[string]func())}
+
+	s.unwatch = []func(){
+		c.AttachDefinition(func(m interface{}) bool {
+			definition := m.(rotonde.Definition)
+			if definition.Type != "event" {
+				return s.active()
+			}
+			return s.add(definition.Identifier)
+		}),
+		c.AttachUnDefinition(func(m interface{}) bool {
+			definition := m.(rotonde.UnDefinition)
+			if definition.Type != "event" {
+				return s.active()
+			}
+			return s.remove(definition.Identifier)
+		}),
+	}
+
+	c.mutex.Lock()
+	identifiers := make([]string, 0, len(c.remoteDefinitions["event"]))
+	for _, definition := range c.remoteDefinitions["event"] {
+		identifiers = append(identifiers, definition.Identifier)
+	}
+	c.mutex.Unlock()
+	for _, identifier := range identifiers {
+		s.add(identifier)
+	}
+	return s.cancel
+}
+
+func (s *patternSubscription) active() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.cancelled == false
+}
+
+func (s *patternSubscription) add(identifier string) bool {
+	s.mutex.Lock()
+	if s.cancelled {
+		s.mutex.Unlock()
+		return false
+	}
+	if s.match(identifier) == false || s.detaches[identifier] != nil {
+		s.mutex.Unlock()
+		return true
+	}
+	// reserved while attaching, outside the lock as subscribing may block
+	pending := func() {}
+	s.detaches[identifier] = pending
+	s.mutex.Unlock()
+
+	detach := s.c.attachNamedEvent(identifier, func(m interface{}) bool {
+		if s.active() && s.fn(m) == false {
+			s.cancel()
+		}
+		return true
+	}, false)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cancelled || s.detaches[identifier] == nil {
+		go detach()
+		return s.cancelled == false
+	}
+	s.detaches[identifier] = detach
+	return true
+}
+
+func (s *patternSubscription) remove(identifier string) bool {
+	s.mutex.Lock()
+	detach := s.detaches[identifier]
+	delete(s.detaches, identifier)
+	cancelled := s.cancelled
+	s.mutex.Unlock()
+	if detach != nil {
+		detach()
+	}
+	return cancelled == false
+}
+
+func (s *patternSubscription) cancel() {
+	s.mutex.Lock()
+	if s.cancelled {
+		s.mutex.Unlock()
+		return
+	}
+	s.cancelled = true
+	detaches := s.detaches
+	s.detaches = nil
+	s.mutex.Unlock()
+	for _, detach := range s.unwatch {
+		detach()
+	}
+	for _, detach := range detaches {
+		detach()
+	}
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"testing"
+)
+
+// handlerCount returns the number of kind-wide handlers of kind.
+func handlerCount(c *Client, kind messageKind) int {
+	c.dispatcher.mutex.Lock()
+	defer c.dispatcher.mutex.Unlock()
+	return len(c.dispatcher.kinds[kind].entries)
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		identifier string
+		match      bool
+	}{
+		{"sensor/*", "sensor/temp", true},
+		{"sensor/*", "sensor/a/b", false},
+		{"sensor/**", "sensor/a/b", true},
+		{"sensor/**", "sensor/temp", true},
+		{"sensor/**", "sensor", true},
+		{"sensor/**/temp", "sensor/a/b/temp", true},
+		{"sensor/**/temp", "sensor/temp", true},
+		{"sensor/**/temp", "sensor/a/hum", false},
+		{"*", "temp", true},
+		{"*", "sensor/temp", false},
+		{"**", "sensor/a/b", true},
+		{"temp_?", "temp_1", true},
+		{"light", "lights", false},
+	}
+	for _, test := range tests {
+		if MatchPattern(test.pattern, test.identifier) != test.match {
+			t.Errorf("MatchPattern(%q, %q) != %v", test.pattern, test.identifier, test.match)
+		}
+	}
+	if ValidatePattern("sensor/[") == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestCancelPatternDetachesDefinitionHandlers(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+
+	cancel, err := c.OnEventPattern("sensor/**", func(m interface{}) bool {
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handlerCount(c, kindDefinition) != 1 || handlerCount(c, kindUnDefinition) != 1 {
+		t.Fatal("definition handlers not attached")
+	}
+	cancel()
+	if handlerCount(c, kindDefinition) != 0 || handlerCount(c, kindUnDefinition) != 0 {
+		t.Fatal("definition handlers still attached after cancel")
+	}
+}
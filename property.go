@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// A property is a value owned by one module. It is set with the
+// <name>_set job, broadcast on the <name>_changed event, and the
+// <name>_get action asks for a broadcast of the current value.
+
+func PropertySetIdentifier(name string) string {
+	return name + "_set"
+}
+
+func PropertyChangedIdentifier(name string) string {
+	return name + "_changed"
+}
+
+func PropertyGetIdentifier(name string) string {
+	return name + "_get"
+}
+
+// PropertySetFunc validates and applies a new value, the value is
+// rejected when it returns an error.
+type PropertySetFunc func(ctx context.Context, value rotonde.Object) error
+
+type Property struct {
+	c    *Client
+	name string
+
+	setMutex *sync.Mutex
+	mutex    *sync.Mutex
+	value    rotonde.Object
+}
+
+// Property declares the property name, with its fields and initial value.
+// Sets only carry the fields they change, set is called with the
+// resulting value. A nil set accepts every value.
+func (c *Client) Property(name string, fields rotonde.FieldDefinitions, initial rotonde.Object, set PropertySetFunc) *Property {
+	p := &Property{c: c, name: name, setMutex: &sync.Mutex{}, mutex: &sync.Mutex{}, value: copyObject(initial)}
+
+	setDefinition := &rotonde.Definition{PropertySetIdentifier(name), "action", false, fields}
+	c.AddLocalDefinition(setDefinition)
+	c.AddLocalDefinition(&rotonde.Definition{PropertyChangedIdentifier(name), "event", false, fields})
+	c.AddLocalDefinition(&rotonde.Definition{PropertyGetIdentifier(name), "action", false, rotonde.FieldDefinitions{}})
+
+	c.OnNamedJob(PropertySetIdentifier(name), func(ctx context.Context, action rotonde.Action, progress ProgressFunc) error {
+		changes := WithoutMetadata(action.Data)
+		if err := validateData(setDefinition, changes); err != nil {
+			return err
+		}
+
+		p.setMutex.Lock()
+		defer p.setMutex.Unlock()
+		value := p.Get()
+		for key, v := range changes {
+			value[key] = v
+		}
+		if set != nil {
+			if err := set(ctx, copyObject(value)); err != nil {
+				return err
+			}
+		}
+		p.store(ctx, value)
+		return nil
+	})
+	c.OnNamedAction(PropertyGetIdentifier(name), func(m interface{}) bool {
+		p.broadcast(context.Background())
+		return true
+	})
+	c.OnStateChange(func(state State) {
+		if state == Connected {
+			go p.broadcast(context.Background())
+		}
+	})
+	return p
+}
+
+// Get returns a copy of the current value.
+func (p *Property) Get() rotonde.Object {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return copyObject(p.value)
+}
+
+// Update changes the value locally, without calling the set callback.
+func (p *Property) Update(value rotonde.Object) {
+	p.setMutex.Lock()
+	defer p.setMutex.Unlock()
+	p.store(context.Background(), copyObject(value))
+}
+
+func (p *Property) store(ctx context.Context, value rotonde.Object) {
+	p.mutex.Lock()
+	p.value = value
+	p.mutex.Unlock()
+	p.broadcast(ctx)
+}
+
+func (p *Property) broadcast(ctx context.Context) {
+	p.c.SendEventContext(ctx, PropertyChangedIdentifier(p.name), p.Get())
+}
+
+// RemoteProperty mirrors a property declared by another module.
+type RemoteProperty struct {
+	c    *Client
+	name string
+
+	mutex *sync.Mutex
+	value rotonde.Object
+	known bool
+}
+
+// RemoteProperty follows the property name, its value is requested right
+// away and after each reconnection.
+func (c *Client) RemoteProperty(name string) *RemoteProperty {
+	r := &RemoteProperty{c: c, name: name, mutex: &sync.Mutex{}}
+	c.OnNamedEvent(PropertyChangedIdentifier(name), func(m interface{}) bool {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.value = WithoutMetadata(m.(rotonde.Event).Data)
+		r.known = true
+		return true
+	})
+	c.OnStateChange(func(state State) {
+		if state == Connected {
+			go c.SendAction(PropertyGetIdentifier(name), rotonde.Object{})
+		}
+	})
+	c.SendAction(PropertyGetIdentifier(name), rotonde.Object{})
+	return r
+}
+
+// Get returns a copy of the latest known value, ok is false until the
+// value is received.
+func (r *RemoteProperty) Get() (value rotonde.Object, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return copyObject(r.value), r.known
+}
+
+// Set changes the fields of value and returns once the owner of the
+// property accepted or rejected them.
+func (r *RemoteProperty) Set(ctx context.Context, value rotonde.Object) error {
+	return r.c.StartJob(ctx, PropertySetIdentifier(r.name), value).Wait(ctx)
+}
+
+func copyObject(data rotonde.Object) rotonde.Object {
+	copied := make(rotonde.Object, len(data))
+	for key, value := range data {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func newModeProperty(c *Client) *Property {
+	fields := rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"level", "number", ""},
+		&rotonde.FieldDefinition{"name", "string", ""},
+	}
+	return c.Property("mode", fields, rotonde.Object{"level": 1.0, "name": "eco"}, func(ctx context.Context, value rotonde.Object) error {
+		if value["level"].(float64) < 0 {
+			return errors.New("negative level")
+		}
+		return nil
+	})
+}
+
+func waitRemoteProperty(t *testing.T, r *RemoteProperty, level float64) rotonde.Object {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if value, ok := r.Get(); ok && value["level"] == level {
+			return value
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	value, _ := r.Get()
+	t.Fatal("remote property is ", value, ", expected level ", level)
+	return nil
+}
+
+func TestProperty(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	p := newModeProperty(c)
+	r := c.RemoteProperty("mode")
+
+	// the initial value is requested with the get action
+	waitRemoteProperty(t, r, 1)
+
+	if err := r.Set(context.Background(), rotonde.Object{"level": 2.0}); err != nil {
+		t.Fatal(err)
+	}
+	if value := p.Get(); value["level"] != 2.0 || value["name"] != "eco" {
+		t.Fatal("unexpected value ", value)
+	}
+	if value := waitRemoteProperty(t, r, 2); value["name"] != "eco" {
+		t.Fatal("unexpected remote value ", value)
+	}
+
+	invalid := []rotonde.Object{{"level": -1.0}, {"level": "high"}, {"unknown": 1.0}}
+	for _, value := range invalid {
+		if err := r.Set(context.Background(), value); err == nil {
+			t.Error(value, " should be rejected")
+		}
+	}
+	if value := p.Get(); value["level"] != 2.0 {
+		t.Fatal("rejected value applied ", value)
+	}
+
+	p.Update(rotonde.Object{"level": 3.0, "name": "boost"})
+	if value := waitRemoteProperty(t, r, 3); value["name"] != "boost" {
+		t.Fatal("unexpected remote value ", value)
+	}
+}
+
+func TestPropertyReconnect(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	newModeProperty(c)
+	changed := c.EventsChan(context.Background(), PropertyChangedIdentifier("mode"), 10)
+	gets := c.ActionsChan(context.Background(), PropertyGetIdentifier("mode"), 10)
+	c.RemoteProperty("mode")
+
+	// the initial get and its answer
+	<-gets
+	<-changed
+
+	c.setState(Connected)
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-changed:
+			if event.Data["level"] != 1.0 {
+				t.Fatal("unexpected event ", event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("property not announced on reconnection")
+		}
+	}
+	select {
+	case <-gets:
+	case <-time.After(2 * time.Second):
+		t.Fatal("remote property not requested on reconnection")
+	}
+}
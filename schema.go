@@ -0,0 +1,247 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema describes the data of an action or event. Units are kept in
+// the x-units extension and the field order in x-order, IsArray turns every
+// field into an array of its type, and x-rotonde-type tells actions from
+// events. The metadata
+// envelope is allowed besides the fields.
+func JSONSchema(d *rotonde.Definition) map[string]interface{} {
+	properties := make(map[string]interface{}, len(d.Fields)+1)
+	properties[MetadataKey] = map[string]interface{}{"type": "object"}
+	for i, field := range d.Fields {
+		// fields without a type accept any value
+		property := map[string]interface{}{}
+		if field.Type != "" {
+			property["type"] = field.Type
+		}
+		if d.IsArray {
+			property = map[string]interface{}{"type": "array", "items": property}
+		}
+		if field.Units != "" {
+			property["x-units"] = field.Units
+		}
+		property["x-order"] = i
+		properties[field.Name] = property
+	}
+	return map[string]interface{}{
+		"$schema":              jsonSchemaDraft,
+		"title":                d.Identifier,
+		"x-rotonde-type":       d.Type,
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// ExportJSONSchemas returns a single JSON Schema document holding the
+// schemas of all the definitions, keyed by "type/identifier".
+func ExportJSONSchemas(definitions rotonde.Definitions) ([]byte, error) {
+	schemas := make(map[string]interface{}, len(definitions))
+	for _, d := range definitions {
+		schema := JSONSchema(d)
+		delete(schema, "$schema")
+		schemas[d.Type+"/"+d.Identifier] = schema
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema":     jsonSchemaDraft,
+		"definitions": schemas,
+	}, "", "  ")
+}
+
+type AsyncAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+	// ServerURL is the rotonde websocket URL, optional.
+	ServerURL string
+}
+
+// ExportAsyncAPI describes the bus as an AsyncAPI 2.6 document, one channel
+// per identifier: events are received with subscribe operations, actions
+// are sent with publish operations.
+func ExportAsyncAPI(definitions rotonde.Definitions, info AsyncAPIInfo) ([]byte, error) {
+	sorted := make(rotonde.Definitions, len(definitions))
+	copy(sorted, definitions)
+	sort.Sort(byIdentifier(sorted))
+
+	channels := make(map[string]interface{})
+	for _, d := range sorted {
+		schema := JSONSchema(d)
+		delete(schema, "$schema")
+		operation := "subscribe"
+		if d.Type == "action" {
+			operation = "publish"
+		}
+		channel, ok := channels[d.Identifier].(map[string]interface{})
+		if ok == false {
+			channel = make(map[string]interface{})
+			channels[d.Identifier] = channel
+		}
+		channel[operation] = map[string]interface{}{
+			"operationId": d.Type + "_" + d.Identifier,
+			"message": map[string]interface{}{
+				"name":    d.Identifier,
+				"payload": schema,
+			},
+		}
+	}
+
+	document := map[string]interface{}{
+		"asyncapi": "2.6.0",
+		"info": map[string]interface{}{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"channels": channels,
+	}
+	if info.ServerURL != "" {
+		document["servers"] = map[string]interface{}{
+			"rotonde": map[string]interface{}{
+				"url":      info.ServerURL,
+				"protocol": "ws",
+			},
+		}
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+type byIdentifier rotonde.Definitions
+
+func (d byIdentifier) Len() int           { return len(d) }
+func (d byIdentifier) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byIdentifier) Less(i, j int) bool { return d[i].Identifier < d[j].Identifier }
+
+type jsonSchema struct {
+	Title       string                 `json:"title"`
+	RotondeType string                 `json:"x-rotonde-type"`
+	Type        string                 `json:"type"`
+	Properties  map[string]*jsonSchema `json:"properties"`
+	Items       *jsonSchema            `json:"items"`
+	Units       string                 `json:"x-units"`
+	Order       *int                   `json:"x-order"`
+	Definitions map[string]*jsonSchema `json:"definitions"`
+	Defs        map[string]*jsonSchema `json:"$defs"`
+}
+
+// ImportJSONSchema builds definitions from a JSON Schema, either a single
+// object schema or a document of schemas under definitions or $defs, as
+// produced by JSONSchema and ExportJSONSchemas.
+func ImportJSONSchema(r io.Reader) (rotonde.Definitions, error) {
+	root := &jsonSchema{}
+	if err := json.NewDecoder(r).Decode(root); err != nil {
+		return nil, err
+	}
+
+	schemas := root.Definitions
+	if len(schemas) == 0 {
+		schemas = root.Defs
+	}
+	if len(schemas) == 0 {
+		d, err := schemaDefinition("", root)
+		if err != nil {
+			return nil, err
+		}
+		return rotonde.Definitions{d}, nil
+	}
+
+	keys := make([]string, 0, len(schemas))
+	for key := range schemas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	definitions := make(rotonde.Definitions, 0, len(schemas))
+	for _, key := range keys {
+		d, err := schemaDefinition(key, schemas[key])
+		if err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, d)
+	}
+	return definitions, nil
+}
+
+func schemaDefinition(key string, schema *jsonSchema) (*rotonde.Definition, error) {
+	d := &rotonde.Definition{Identifier: schema.Title, Type: schema.RotondeType}
+	if d.Identifier == "" {
+		d.Identifier = key
+	}
+	if d.Identifier == "" {
+		return nil, errors.New("schema without title")
+	}
+	if d.Type == "" {
+		d.Type = "event"
+	}
+	if schema.Type != "" && schema.Type != "object" {
+		return nil, errors.New(fmt.Sprint(d.Identifier, ": schema type must be object"))
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		if name != MetadataKey {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(byOrder{names, schema.Properties})
+	for i, name := range names {
+		property := schema.Properties[name]
+		isArray := property.Type == "array"
+		if i > 0 && isArray != d.IsArray {
+			return nil, errors.New(fmt.Sprint(d.Identifier, ": fields must all be arrays or none"))
+		}
+		d.IsArray = isArray
+		units := property.Units
+		if isArray {
+			if property.Items == nil {
+				return nil, errors.New(fmt.Sprint(d.Identifier, ".", name, ": array without items"))
+			}
+			property = property.Items
+			if units == "" {
+				units = property.Units
+			}
+		}
+		typ := property.Type
+		if typ == "integer" {
+			typ = "number"
+		}
+		if typ != "" && typ != "number" && typ != "string" && typ != "boolean" {
+			return nil, errors.New(fmt.Sprint(d.Identifier, ".", name, ": unsupported type ", property.Type))
+		}
+		d.PushField(name, typ, units)
+	}
+	return d, nil
+}
+
+// byOrder sorts properties by x-order, those without it come last sorted
+// by name.
+type byOrder struct {
+	names      []string
+	properties map[string]*jsonSchema
+}
+
+func (o byOrder) Len() int      { return len(o.names) }
+func (o byOrder) Swap(i, j int) { o.names[i], o.names[j] = o.names[j], o.names[i] }
+func (o byOrder) Less(i, j int) bool {
+	a, b := o.properties[o.names[i]].Order, o.properties[o.names[j]].Order
+	switch {
+	case a != nil && b != nil && *a != *b:
+		return *a < *b
+	case a != nil && b == nil:
+		return true
+	case a == nil && b != nil:
+		return false
+	}
+	return o.names[i] < o.names[j]
+}
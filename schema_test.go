@@ -0,0 +1,88 @@
+package client
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func TestJSONSchemaRoundTrip(t *testing.T) {
+	definitions := rotonde.Definitions{
+		&rotonde.Definition{"light/on", "action", false, rotonde.FieldDefinitions{
+			&rotonde.FieldDefinition{"level", "number", "%"},
+			&rotonde.FieldDefinition{"payload", "", ""},
+		}},
+		&rotonde.Definition{"temp", "event", true, rotonde.FieldDefinitions{
+			&rotonde.FieldDefinition{"room", "string", ""},
+			&rotonde.FieldDefinition{"value", "", "°C"},
+		}},
+	}
+	document, err := ExportJSONSchemas(definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(document, []byte(`"type": ""`)) {
+		t.Fatal("untyped fields exported with an empty type: ", string(document))
+	}
+	if bytes.Contains(document, []byte(`"`+MetadataKey+`"`)) == false {
+		t.Fatal("the metadata envelope is not allowed: ", string(document))
+	}
+	imported, err := ImportJSONSchema(bytes.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(imported, definitions) == false {
+		t.Fatalf("imported %v, expected %v", imported, definitions)
+	}
+}
+
+func TestJSONSchemaFieldOrder(t *testing.T) {
+	definition := &rotonde.Definition{"move", "action", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"z", "number", "m"},
+		&rotonde.FieldDefinition{"y", "number", "m"},
+		&rotonde.FieldDefinition{"x", "number", "m"},
+		&rotonde.FieldDefinition{"speed", "number", "m/s"},
+	}}
+	document, err := ExportJSONSchemas(rotonde.Definitions{definition})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportJSONSchema(bytes.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 1 || reflect.DeepEqual(imported[0], definition) == false {
+		t.Fatalf("imported %v, expected %v", imported, definition)
+	}
+
+	// properties without x-order follow the ordered ones, sorted by name
+	schema := `{"title": "move", "properties": {"b": {}, "z": {"x-order": 1}, "a": {}, "y": {"x-order": 0}}}`
+	imported, err = ImportJSONSchema(bytes.NewReader([]byte(schema)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, field := range imported[0].Fields {
+		names = append(names, field.Name)
+	}
+	if reflect.DeepEqual(names, []string{"y", "z", "a", "b"}) == false {
+		t.Fatal("imported fields in order ", names)
+	}
+}
+
+func TestImportJSONSchemaErrors(t *testing.T) {
+	schemas := []string{
+		`{"properties": {"a": {"type": "number"}}}`,
+		`{"title": "a", "type": "array"}`,
+		`{"title": "a", "properties": {"a": {"type": "object"}}}`,
+		`{"title": "a", "properties": {"a": {"type": "array"}}}`,
+		`{"title": "a", "properties": {"a": {"type": "array", "items": {}}, "b": {"type": "number"}}}`,
+	}
+	for _, schema := range schemas {
+		if _, err := ImportJSONSchema(bytes.NewReader([]byte(schema))); err == nil {
+			t.Errorf("%v should not be imported", schema)
+		}
+	}
+}
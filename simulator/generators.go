@@ -0,0 +1,131 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Generator produces the values of a field, elapsed being the time since
+// the simulator started.
+type Generator interface {
+	Next(elapsed time.Duration) interface{}
+}
+
+type GeneratorFunc func(elapsed time.Duration) interface{}
+
+func (f GeneratorFunc) Next(elapsed time.Duration) interface{} {
+	return f(elapsed)
+}
+
+func Constant(value interface{}) Generator {
+	return GeneratorFunc(func(time.Duration) interface{} {
+		return value
+	})
+}
+
+// RandomRange generates numbers uniformly distributed in [min, max).
+func RandomRange(min, max float64) Generator {
+	return GeneratorFunc(func(time.Duration) interface{} {
+		return min + rand.Float64()*(max-min)
+	})
+}
+
+// Sine generates offset + amplitude * sin(2π elapsed / period), period
+// must be positive.
+func Sine(amplitude float64, period time.Duration, offset float64) (Generator, error) {
+	if period <= 0 {
+		return nil, errors.New(fmt.Sprint("sine period must be positive, got ", period))
+	}
+	return GeneratorFunc(func(elapsed time.Duration) interface{} {
+		return offset + amplitude*math.Sin(2*math.Pi*elapsed.Seconds()/period.Seconds())
+	}), nil
+}
+
+func randomBool() Generator {
+	return GeneratorFunc(func(time.Duration) interface{} {
+		return rand.Intn(2) == 1
+	})
+}
+
+func randomString() Generator {
+	return GeneratorFunc(func(time.Duration) interface{} {
+		return fmt.Sprint("sim-", rand.Intn(1000))
+	})
+}
+
+// defaultGenerator is used for the fields without generator, according to
+// their type.
+func defaultGenerator(fieldType string) Generator {
+	switch fieldType {
+	case "string":
+		return randomString()
+	case "boolean":
+		return randomBool()
+	}
+	return RandomRange(0, 100)
+}
+
+type csvReplay struct {
+	mutex  *sync.Mutex
+	values []interface{}
+	next   int
+}
+
+// CSVReplay replays a column of a CSV file, whose first row holds the
+// column names, looping at the end. Numbers and booleans are parsed, other
+// cells are kept as strings.
+func CSVReplay(r io.Reader, column string) (Generator, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, errors.New("csv without values")
+	}
+	index := -1
+	for i, name := range records[0] {
+		if name == column {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, errors.New(fmt.Sprint("csv without column ", column))
+	}
+
+	g := &csvReplay{mutex: &sync.Mutex{}}
+	for _, record := range records[1:] {
+		if index >= len(record) {
+			continue
+		}
+		g.values = append(g.values, parseCell(record[index]))
+	}
+	if len(g.values) == 0 {
+		return nil, errors.New(fmt.Sprint("csv without values for ", column))
+	}
+	return g, nil
+}
+
+func parseCell(cell string) interface{} {
+	if f, err := strconv.ParseFloat(cell, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(cell); err == nil {
+		return b
+	}
+	return cell
+}
+
+func (g *csvReplay) Next(time.Duration) interface{} {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	value := g.values[g.next]
+	g.next = (g.next + 1) % len(g.values)
+	return value
+}
@@ -0,0 +1,67 @@
+package simulator
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSine(t *testing.T) {
+	g, err := Sine(2, 4*time.Second, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[time.Duration]float64{0: 10, time.Second: 12, 2 * time.Second: 10, 3 * time.Second: 8}
+	for elapsed, expected := range values {
+		if value := g.Next(elapsed).(float64); math.Abs(value-expected) > 1e-9 {
+			t.Errorf("sine at %v is %v, expected %v", elapsed, value, expected)
+		}
+	}
+	for _, period := range []time.Duration{0, -time.Second} {
+		if _, err := Sine(1, period, 0); err == nil {
+			t.Errorf("period %v should be rejected", period)
+		}
+	}
+}
+
+func TestRandomRange(t *testing.T) {
+	g := RandomRange(-1, 1)
+	for i := 0; i < 100; i++ {
+		if value := g.Next(0).(float64); value < -1 || value >= 1 {
+			t.Fatal(value, " out of [-1, 1)")
+		}
+	}
+}
+
+func TestCSVReplay(t *testing.T) {
+	csv := "time,temp,on,room\n0,21.5,true,kitchen\n1,22,false,\n"
+	expected := map[string][]interface{}{
+		"temp": {21.5, 22.0, 21.5},
+		"on":   {true, false, true},
+		"room": {"kitchen", "", "kitchen"},
+	}
+	for column, values := range expected {
+		g, err := CSVReplay(strings.NewReader(csv), column)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, value := range values {
+			if v := g.Next(0); v != value {
+				t.Errorf("%v value %v is %#v, expected %#v", column, i, v, value)
+			}
+		}
+	}
+
+	invalid := []struct{ csv, column string }{
+		{"temp\n", "temp"},
+		{"temp\n1\n", "hum"},
+		{"temp,hum\n1\n", "hum"},
+		{"\"temp\n", "temp"},
+	}
+	for _, c := range invalid {
+		if _, err := CSVReplay(strings.NewReader(c.csv), c.column); err == nil {
+			t.Errorf("%q column %v should not replay", c.csv, c.column)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/HackerLoop/rotonde-client.go"
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// LoadDefinitions reads a JSON array of definitions, as listed by the
+// gateway or captured from a live catalog.
+func LoadDefinitions(r io.Reader) (rotonde.Definitions, error) {
+	definitions := rotonde.Definitions{}
+	if err := json.NewDecoder(r).Decode(&definitions); err != nil {
+		return nil, err
+	}
+	return definitions, nil
+}
+
+// Response is emitted when an action is received, the event data is
+// generated from its definition when Data is nil.
+type Response struct {
+	Event string
+	Data  rotonde.Object
+	Delay time.Duration
+}
+
+// Simulator declares definitions on a client as if it were the module
+// implementing them, emits their events with generated values and answers
+// their actions.
+type Simulator struct {
+	c           *client.Client
+	definitions map[string]*rotonde.Definition
+
+	// Interval between two events of an identifier, unless set with
+	// SetInterval.
+	Interval time.Duration
+	// ArrayLength is the number of values of the fields of IsArray events.
+	ArrayLength int
+
+	mutex      *sync.Mutex
+	intervals  map[string]time.Duration
+	generators map[string]map[string]Generator
+	responses  map[string][]Response
+	start      time.Time
+	running    bool
+}
+
+func New(c *client.Client, definitions rotonde.Definitions) *Simulator {
+	s := &Simulator{
+		c:           c,
+		definitions: make(map[string]*rotonde.Definition),
+		Interval:    time.Second,
+		ArrayLength: 3,
+		mutex:       &sync.Mutex{},
+		intervals:   make(map[string]time.Duration),
+		generators:  make(map[string]map[string]Generator),
+		responses:   make(map[string][]Response),
+	}
+	for _, definition := range definitions {
+		s.definitions[definition.Type+"/"+definition.Identifier] = definition
+	}
+	return s
+}
+
+// SetGenerator generates the values of a field of the event identifier,
+// fields without generator get random values of their type.
+func (s *Simulator) SetGenerator(identifier, field string, g Generator) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.generators[identifier] == nil {
+		s.generators[identifier] = make(map[string]Generator)
+	}
+	s.generators[identifier][field] = g
+}
+
+// SetInterval sets the interval between two events of identifier, a
+// negative interval disables the event, which can still be a response.
+func (s *Simulator) SetInterval(identifier string, interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.intervals[identifier] = interval
+}
+
+// SetResponses sets the events emitted when the action identifier is
+// received, actions without responses are ignored.
+func (s *Simulator) SetResponses(identifier string, responses ...Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses[identifier] = responses
+}
+
+// Generate returns event data for the definition of the event identifier,
+// respecting its field types and IsArray.
+func (s *Simulator) Generate(identifier string) (rotonde.Object, error) {
+	definition, ok := s.definitions["event/"+identifier]
+	if ok == false {
+		return nil, errors.New(fmt.Sprint("no event definition for ", identifier))
+	}
+
+	s.mutex.Lock()
+	elapsed := time.Since(s.start)
+	generators := make(map[string]Generator)
+	for _, field := range definition.Fields {
+		generator, ok := s.generators[identifier][field.Name]
+		if ok == false {
+			generator = defaultGenerator(field.Type)
+		}
+		generators[field.Name] = generator
+	}
+	s.mutex.Unlock()
+
+	data := rotonde.Object{}
+	for name, generator := range generators {
+		if definition.IsArray == false {
+			data[name] = generator.Next(elapsed)
+			continue
+		}
+		values := make([]interface{}, s.ArrayLength)
+		for i := range values {
+			values[i] = generator.Next(elapsed)
+		}
+		data[name] = values
+	}
+	return data, nil
+}
+
+// Run declares the definitions and simulates them until ctx is done, the
+// definitions are then removed. The client is left open.
+func (s *Simulator) Run(ctx context.Context) error {
+	s.mutex.Lock()
+	if s.running {
+		s.mutex.Unlock()
+		return errors.New("simulator already running")
+	}
+	s.running = true
+	s.start = time.Now()
+	s.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, definition := range s.definitions {
+		s.c.AddLocalDefinition(definition)
+		switch definition.Type {
+		case "event":
+			wg.Add(1)
+			go func(identifier string) {
+				defer wg.Done()
+				s.emitEvents(ctx, identifier)
+			}(definition.Identifier)
+		case "action":
+			s.answerActions(ctx, definition.Identifier)
+		}
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+	for _, definition := range s.definitions {
+		s.c.RemoveLocalDefinition(definition.Type, definition.Identifier)
+	}
+
+	s.mutex.Lock()
+	s.running = false
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *Simulator) emitEvents(ctx context.Context, identifier string) {
+	for {
+		s.mutex.Lock()
+		interval, ok := s.intervals[identifier]
+		if ok == false {
+			interval = s.Interval
+		}
+		s.mutex.Unlock()
+		if interval < 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		s.emit(identifier, nil)
+	}
+}
+
+func (s *Simulator) emit(identifier string, data rotonde.Object) {
+	if data == nil {
+		var err error
+		data, err = s.Generate(identifier)
+		if err != nil {
+			s.c.Logger().Warn("cannot generate event", client.Fields{"identifier": identifier, "error": err})
+			return
+		}
+	}
+	s.c.SendEvent(identifier, data)
+}
+
+func (s *Simulator) answerActions(ctx context.Context, identifier string) {
+	s.c.OnNamedAction(identifier, func(m interface{}) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		default:
+		}
+
+		s.mutex.Lock()
+		responses := s.responses[identifier]
+		s.mutex.Unlock()
+		if len(responses) == 0 {
+			s.c.Logger().Debug("no response for action", client.Fields{"identifier": identifier})
+			return true
+		}
+
+		go func() {
+			for _, response := range responses {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(response.Delay):
+				}
+				s.emit(response.Event, response.Data)
+			}
+		}()
+		return true
+	})
+}
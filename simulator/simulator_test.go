@@ -0,0 +1,205 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde-client.go"
+	"github.com/HackerLoop/rotonde/shared"
+	"github.com/gorilla/websocket"
+)
+
+// fakeRotonde is a websocket server recording the packets it receives, and
+// sending packets to the connected client.
+type fakeRotonde struct {
+	server *httptest.Server
+
+	mutex    *sync.Mutex
+	conn     *websocket.Conn
+	received []interface{}
+}
+
+func newFakeRotonde(t *testing.T) *fakeRotonde {
+	f := &fakeRotonde{mutex: &sync.Mutex{}}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f.mutex.Lock()
+		f.conn = conn
+		f.mutex.Unlock()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			packet, err := rotonde.FromJSON(bytes.NewReader(data))
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			f.mutex.Lock()
+			f.received = append(f.received, packet)
+			f.mutex.Unlock()
+		}
+	}))
+	return f
+}
+
+func (f *fakeRotonde) url() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+func (f *fakeRotonde) send(t *testing.T, packet interface{}) {
+	data, err := rotonde.ToJSON(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitReceived returns the first received packet accepted by match.
+func (f *fakeRotonde) waitReceived(t *testing.T, what string, match func(interface{}) bool) interface{} {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mutex.Lock()
+		for _, packet := range f.received {
+			if match(packet) {
+				f.mutex.Unlock()
+				return packet
+			}
+		}
+		f.mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal(what, " not received")
+	return nil
+}
+
+func (f *fakeRotonde) close() {
+	f.mutex.Lock()
+	if f.conn != nil {
+		f.conn.Close()
+	}
+	f.mutex.Unlock()
+	f.server.Close()
+}
+
+var testDefinitions = `[
+	{"identifier": "temp", "type": "event", "isarray": false, "fields": [
+		{"name": "value", "type": "number", "units": "°C"},
+		{"name": "on", "type": "boolean", "units": ""},
+		{"name": "room", "type": "string", "units": ""}
+	]},
+	{"identifier": "samples", "type": "event", "isarray": true, "fields": [
+		{"name": "value", "type": "number", "units": ""}
+	]},
+	{"identifier": "ping", "type": "action", "isarray": false, "fields": []},
+	{"identifier": "pong", "type": "event", "isarray": false, "fields": [
+		{"name": "value", "type": "number", "units": ""}
+	]}
+]`
+
+func TestGenerate(t *testing.T) {
+	definitions, err := LoadDefinitions(strings.NewReader(testDefinitions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.NewClient("ws://127.0.0.1:0", client.WithLogger(client.NopLogger()))
+	defer c.Close()
+	s := New(c, definitions)
+	s.SetGenerator("temp", "room", Constant("kitchen"))
+
+	data, err := s.Generate("temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data["value"].(float64); ok == false {
+		t.Error("value is ", data["value"])
+	}
+	if _, ok := data["on"].(bool); ok == false {
+		t.Error("on is ", data["on"])
+	}
+	if data["room"] != "kitchen" {
+		t.Error("room is ", data["room"])
+	}
+
+	data, err = s.Generate("samples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, ok := data["value"].([]interface{}); ok == false || len(values) != s.ArrayLength {
+		t.Error("samples are ", data["value"])
+	}
+
+	for _, identifier := range []string{"ping", "unknown"} {
+		if _, err := s.Generate(identifier); err == nil {
+			t.Error(identifier, " should not be generated")
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	definitions, err := LoadDefinitions(strings.NewReader(testDefinitions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFakeRotonde(t)
+	defer f.close()
+	c := client.NewClient(f.url(), client.WithLogger(client.NopLogger()))
+	defer c.Close()
+
+	s := New(c, definitions)
+	s.Interval = 10 * time.Millisecond
+	s.SetInterval("pong", -1)
+	s.SetResponses("ping", Response{Event: "pong", Data: rotonde.Object{"value": 1.0}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	f.waitReceived(t, "definition", func(packet interface{}) bool {
+		definition, ok := packet.(rotonde.Definition)
+		return ok && definition.Identifier == "ping"
+	})
+	f.waitReceived(t, "event", func(packet interface{}) bool {
+		event, ok := packet.(rotonde.Event)
+		return ok && event.Identifier == "temp"
+	})
+	if err := s.Run(ctx); err == nil {
+		t.Fatal("simulator started twice")
+	}
+
+	f.send(t, rotonde.Action{"ping", rotonde.Object{}})
+	f.waitReceived(t, "response", func(packet interface{}) bool {
+		event, ok := packet.(rotonde.Event)
+		return ok && event.Identifier == "pong" && event.Data["value"] == 1.0
+	})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("simulator still running")
+	}
+	f.waitReceived(t, "undefinition", func(packet interface{}) bool {
+		undefinition, ok := packet.(rotonde.UnDefinition)
+		return ok && undefinition.Identifier == "temp"
+	})
+}
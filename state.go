@@ -0,0 +1,123 @@
+package client
+
+import (
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+type State int
+
+const (
+	Disconnected State = iota
+	Connecting
+	Connected
+	Closed
+)
+
+func (s State) String() string {
+	switch s {
+	case Disconnected:
+		return "disconnected"
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Closed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+func (c *Client) State() State {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	return c.state
+}
+
+// OnStateChange registers fn to be called from the connection goroutine
+// each time the connection state changes.
+func (c *Client) OnStateChange(fn func(State)) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.stateHandlers = append(c.stateHandlers, fn)
+}
+
+func (c *Client) setState(state State) {
+	c.stateMutex.Lock()
+	if c.state == state || c.state == Closed {
+		c.stateMutex.Unlock()
+		return
+	}
+	c.state = state
+	stateHandlers := make([]func(State), len(c.stateHandlers))
+	copy(stateHandlers, c.stateHandlers)
+	c.stateMutex.Unlock()
+
+	for _, fn := range stateHandlers {
+		fn(state)
+	}
+}
+
+// subscribe and unsubscribe count the interested parties for each identifier,
+// the Subscription and Unsubscription packets are only sent for the first and
+// the last of them.
+func (c *Client) subscribe(identifier string) {
+	c.subscriptionMutex.Lock()
+	c.subscriptions[identifier]++
+	first := c.subscriptions[identifier] == 1
+	session := c.session
+	c.subscriptionMutex.Unlock()
+	if first {
+		c.jsonInChan <- sessionPacket{session, rotonde.Subscription{identifier}}
+	}
+}
+
+func (c *Client) unsubscribe(identifier string) {
+	c.subscriptionMutex.Lock()
+	count, ok := c.subscriptions[identifier]
+	if ok == false {
+		c.subscriptionMutex.Unlock()
+		return
+	}
+	if count > 1 {
+		c.subscriptions[identifier] = count - 1
+		c.subscriptionMutex.Unlock()
+		return
+	}
+	delete(c.subscriptions, identifier)
+	session := c.session
+	c.subscriptionMutex.Unlock()
+	c.jsonInChan <- sessionPacket{session, rotonde.Unsubscription{identifier}}
+}
+
+// sessionPacket carries a packet reflecting the local definitions or the
+// subscriptions, queued during session. Packets of previous sessions are
+// not written, the replay of the current session already covers them.
+type sessionPacket struct {
+	session uint64
+	packet  interface{}
+}
+
+// replayPackets starts a new session and returns the packets that have to
+// be sent again each time a new connection is established, rotonde
+// forgets everything about a connection once it is closed.
+func (c *Client) replayPackets() ([]interface{}, uint64) {
+	packets := make([]interface{}, 0, 10)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, definitions := range c.localDefinitions {
+		for _, definition := range definitions {
+			packets = append(packets, *definition)
+		}
+	}
+
+	c.subscriptionMutex.Lock()
+	defer c.subscriptionMutex.Unlock()
+	for identifier := range c.subscriptions {
+		packets = append(packets, rotonde.Subscription{identifier})
+	}
+
+	// session is written holding both locks, and read holding either
+	c.session++
+	return packets, c.session
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// Stream is a flow of event data, built from received events with
+// c.Stream, transformed by operators and sent again as a new event with
+// Publish. All the goroutines of a stream stop when the client is closed.
+//
+// Operators and Publish consume the data of the stream they are applied
+// to, applying two of them to the same stream splits its data between them.
+type Stream struct {
+	c    *Client
+	data <-chan rotonde.Object
+}
+
+// Stream follows the events of identifier. With the default OverflowBlock
+// policy, no event is lost: a slow stream delays the other handlers of the
+// identifier instead.
+func (c *Client) Stream(identifier string, policy ...OverflowPolicy) *Stream {
+	if len(policy) == 0 {
+		policy = []OverflowPolicy{OverflowBlock}
+	}
+	events := c.EventsChan(c.ctx, identifier, 10, policy...)
+	return c.newStream(func(out chan<- rotonde.Object) {
+		for event := range events {
+			if c.emit(out, event.Data) == false {
+				return
+			}
+		}
+	})
+}
+
+// newStream runs fn in its own goroutine, out is closed when fn returns.
+func (c *Client) newStream(fn func(out chan<- rotonde.Object)) *Stream {
+	out := make(chan rotonde.Object, 10)
+	go func() {
+		defer close(out)
+		fn(out)
+	}()
+	return &Stream{c, out}
+}
+
+func (c *Client) emit(out chan<- rotonde.Object, data rotonde.Object) bool {
+	select {
+	case out <- data:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+func (s *Stream) Map(fn func(rotonde.Object) rotonde.Object) *Stream {
+	return s.c.newStream(func(out chan<- rotonde.Object) {
+		for data := range s.data {
+			if s.c.emit(out, fn(data)) == false {
+				return
+			}
+		}
+	})
+}
+
+func (s *Stream) Filter(fn func(rotonde.Object) bool) *Stream {
+	return s.c.newStream(func(out chan<- rotonde.Object) {
+		for data := range s.data {
+			if fn(data) == false {
+				continue
+			}
+			if s.c.emit(out, data) == false {
+				return
+			}
+		}
+	})
+}
+
+func (s *Stream) Where(filter Filter) *Stream {
+	return s.Filter(filter.Match)
+}
+
+// Debounce only lets data through once the stream has been quiet for d,
+// the pending data is sent when the stream ends.
+func (s *Stream) Debounce(d time.Duration) *Stream {
+	return s.c.newStream(func(out chan<- rotonde.Object) {
+		var pending rotonde.Object
+		hasPending := false
+		timer := time.NewTimer(d)
+		timer.Stop()
+		defer timer.Stop()
+		for {
+			select {
+			case data, ok := <-s.data:
+				if ok == false {
+					if hasPending {
+						s.c.emit(out, pending)
+					}
+					return
+				}
+				pending, hasPending = data, true
+				timer.Reset(d)
+			case <-timer.C:
+				if s.c.emit(out, pending) == false {
+					return
+				}
+				pending, hasPending = nil, false
+			case <-s.c.ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// Window groups the data of a stream, see Reduce.
+type Window struct {
+	s     *Stream
+	count int
+	every time.Duration
+}
+
+// WindowCount groups data by n consecutive values.
+func (s *Stream) WindowCount(n int) *Window {
+	if n < 1 {
+		n = 1
+	}
+	return &Window{s: s, count: n}
+}
+
+// WindowTime groups the data received during each period d.
+func (s *Stream) WindowTime(d time.Duration) *Window {
+	return &Window{s: s, every: d}
+}
+
+// Reduce sends the result of fn for each window, the last window is
+// reduced when the stream ends, even when it is not complete.
+func (w *Window) Reduce(fn func([]rotonde.Object) rotonde.Object) *Stream {
+	s := w.s
+	return s.c.newStream(func(out chan<- rotonde.Object) {
+		window := make([]rotonde.Object, 0, w.count)
+		var tick <-chan time.Time
+		if w.every > 0 {
+			ticker := time.NewTicker(w.every)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case data, ok := <-s.data:
+				if ok == false {
+					if len(window) > 0 {
+						s.c.emit(out, fn(window))
+					}
+					return
+				}
+				window = append(window, data)
+				if w.count == 0 || len(window) < w.count {
+					continue
+				}
+			case <-tick:
+				if len(window) == 0 {
+					continue
+				}
+			case <-s.c.ctx.Done():
+				return
+			}
+			if s.c.emit(out, fn(window)) == false {
+				return
+			}
+			window = make([]rotonde.Object, 0, w.count)
+		}
+	})
+}
+
+// Join combines the latest data of a and b each time one of them changes,
+// once both have received at least one value.
+func Join(a, b *Stream, fn func(a, b rotonde.Object) rotonde.Object) *Stream {
+	return a.c.newStream(func(out chan<- rotonde.Object) {
+		var lastA, lastB rotonde.Object
+		inA, inB := a.data, b.data
+		for inA != nil || inB != nil {
+			select {
+			case data, ok := <-inA:
+				if ok == false {
+					inA = nil
+					continue
+				}
+				lastA = data
+			case data, ok := <-inB:
+				if ok == false {
+					inB = nil
+					continue
+				}
+				lastB = data
+			case <-a.c.ctx.Done():
+				return
+			}
+			if lastA == nil || lastB == nil {
+				continue
+			}
+			if a.c.emit(out, fn(lastA, lastB)) == false {
+				return
+			}
+		}
+	})
+}
+
+// Publish declares a copy of definition as a local event, and sends every
+// data of the stream with its identifier. The definition is removed when
+// the stream ends before the client.
+func (s *Stream) Publish(definition *rotonde.Definition) {
+	event := *definition
+	event.Type = "event"
+	s.c.AddLocalDefinition(&event)
+	go func() {
+		for data := range s.data {
+			s.c.SendEvent(event.Identifier, data)
+		}
+		// nothing reads the outbound queue anymore once the client is closed
+		if s.c.ctx.Err() == nil {
+			s.c.RemoveLocalDefinition("event", event.Identifier)
+		}
+	}()
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func newLoopbackClient(t *testing.T) *Client {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	loopback(t, c)
+	return c
+}
+
+// published returns the values of the n first events of identifier.
+func published(t *testing.T, events <-chan rotonde.Event, n int) []float64 {
+	values := make([]float64, 0, n)
+	for len(values) < n {
+		select {
+		case event := <-events:
+			values = append(values, event.Data["value"].(float64))
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %v, expected %v values", values, n)
+		}
+	}
+	return values
+}
+
+func expectValues(t *testing.T, values []float64, expected ...float64) {
+	if len(values) != len(expected) {
+		t.Fatalf("received %v, expected %v", values, expected)
+	}
+	for i := range values {
+		if values[i] != expected[i] {
+			t.Fatalf("received %v, expected %v", values, expected)
+		}
+	}
+}
+
+func sendValues(c *Client, identifier string, values ...float64) {
+	for _, value := range values {
+		c.SendEvent(identifier, rotonde.Object{"value": value})
+	}
+}
+
+func valueOf(data rotonde.Object) float64 {
+	return data["value"].(float64)
+}
+
+func TestStreamMapFilter(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	events := c.EventsChan(context.Background(), "doubled", 100)
+
+	definition := &rotonde.Definition{"doubled", "", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"value", "number", ""},
+	}}
+	c.Stream("temp").Filter(func(data rotonde.Object) bool {
+		return valueOf(data) > 0
+	}).Map(func(data rotonde.Object) rotonde.Object {
+		return rotonde.Object{"value": 2 * valueOf(data)}
+	}).Publish(definition)
+
+	if definition.Type != "" {
+		t.Fatal("Publish modified the definition")
+	}
+	if _, err := c.getLocalDefinition("event", "doubled"); err != nil {
+		t.Fatal(err)
+	}
+	sendValues(c, "temp", 1, -2, 3, 0, 4)
+	expectValues(t, published(t, events, 3), 2, 6, 8)
+}
+
+func TestStreamDoesNotDropEvents(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	events := c.EventsChan(context.Background(), "slow", 100)
+
+	unblock := make(chan bool)
+	c.Stream("temp").Map(func(data rotonde.Object) rotonde.Object {
+		<-unblock
+		return data
+	}).Publish(&rotonde.Definition{"slow", "event", false, nil})
+
+	values := make([]float64, 50)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	sendValues(c, "temp", values...)
+	time.Sleep(20 * time.Millisecond)
+	close(unblock)
+	expectValues(t, published(t, events, len(values)), values...)
+}
+
+func sum(window []rotonde.Object) rotonde.Object {
+	total := 0.0
+	for _, data := range window {
+		total += valueOf(data)
+	}
+	return rotonde.Object{"value": total}
+}
+
+func TestStreamWindowCount(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	events := c.EventsChan(context.Background(), "sums", 100)
+
+	c.Stream("temp").WindowCount(3).Reduce(sum).Publish(&rotonde.Definition{"sums", "event", false, nil})
+	sendValues(c, "temp", 1, 2, 3, 4, 5, 6, 7)
+	expectValues(t, published(t, events, 2), 6, 15)
+}
+
+func TestStreamWindowTime(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	events := c.EventsChan(context.Background(), "sums", 100)
+
+	c.Stream("temp").WindowTime(100 * time.Millisecond).Reduce(sum).Publish(&rotonde.Definition{"sums", "event", false, nil})
+	sendValues(c, "temp", 1, 2, 3)
+	expectValues(t, published(t, events, 1), 6)
+	sendValues(c, "temp", 4)
+	expectValues(t, published(t, events, 1), 4)
+}
+
+func TestStreamDebounce(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	events := c.EventsChan(context.Background(), "settled", 100)
+
+	c.Stream("temp").Debounce(50 * time.Millisecond).Publish(&rotonde.Definition{"settled", "event", false, nil})
+	sendValues(c, "temp", 1, 2, 3)
+	expectValues(t, published(t, events, 1), 3)
+	select {
+	case event := <-events:
+		t.Fatal("unexpected event ", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestStreamJoin(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	events := c.EventsChan(context.Background(), "total", 100)
+
+	a, b := c.Stream("a"), c.Stream("b")
+	Join(a, b, func(a, b rotonde.Object) rotonde.Object {
+		return rotonde.Object{"value": valueOf(a) + valueOf(b)}
+	}).Publish(&rotonde.Definition{"total", "event", false, nil})
+
+	sendValues(c, "a", 1)
+	time.Sleep(20 * time.Millisecond)
+	sendValues(c, "b", 10)
+	expectValues(t, published(t, events, 1), 11)
+	sendValues(c, "a", 2)
+	expectValues(t, published(t, events, 1), 12)
+}
+
+// The pending data of Debounce and the last window of Reduce are sent when
+// their input ends.
+func TestStreamFlushOnEnd(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+
+	debounced := make(chan rotonde.Object, 1)
+	debounced <- rotonde.Object{"value": 1.0}
+	close(debounced)
+	reduced := make(chan rotonde.Object, 2)
+	reduced <- rotonde.Object{"value": 1.0}
+	reduced <- rotonde.Object{"value": 2.0}
+	close(reduced)
+
+	streams := []*Stream{
+		(&Stream{c, debounced}).Debounce(time.Hour),
+		(&Stream{c, reduced}).WindowCount(10).Reduce(sum),
+	}
+	for i, expected := range []float64{1, 3} {
+		select {
+		case data, ok := <-streams[i].data:
+			if ok == false || valueOf(data) != expected {
+				t.Fatalf("stream %v ended with %v, expected %v", i, data, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("stream %v not flushed", i)
+		}
+	}
+}
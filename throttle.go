@@ -0,0 +1,145 @@
+package client
+
+import (
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// ThrottleConfig limits the rate of outgoing events for one identifier.
+// Rate is expressed in events per second, Burst is the token bucket size.
+// When Coalesce is set, events exceeding the rate are not dropped, the
+// latest one is kept and sent as soon as the bucket allows it.
+type ThrottleConfig struct {
+	Rate     float64
+	Burst    int
+	Coalesce bool
+}
+
+type ThrottleStats struct {
+	Sent      uint64
+	Dropped   uint64
+	Coalesced uint64
+}
+
+type throttle struct {
+	config  ThrottleConfig
+	tokens  float64
+	last    time.Time
+	pending rotonde.Object
+	timer   *time.Timer
+	stats   ThrottleStats
+}
+
+func (t *throttle) burst() float64 {
+	if t.config.Burst < 1 {
+		return 1
+	}
+	return float64(t.config.Burst)
+}
+
+func (t *throttle) refill(now time.Time) {
+	t.tokens += now.Sub(t.last).Seconds() * t.config.Rate
+	if t.tokens > t.burst() {
+		t.tokens = t.burst()
+	}
+	t.last = now
+}
+
+// SetEventThrottle configures the throttling of SendEvent for identifier,
+// a zero Rate removes it. The event coalesced by the previous
+// configuration, if any, is sent right away.
+func (c *Client) SetEventThrottle(identifier string, config ThrottleConfig) {
+	c.throttleMutex.Lock()
+	var pending rotonde.Object
+	if t, ok := c.throttles[identifier]; ok == true {
+		if t.timer != nil {
+			t.timer.Stop()
+			t.timer = nil
+		}
+		if t.pending != nil {
+			pending = t.pending
+			t.pending = nil
+			t.stats.Sent++
+		}
+	}
+	if config.Rate <= 0 {
+		delete(c.throttles, identifier)
+	} else {
+		t := &throttle{config: config, last: time.Now()}
+		t.tokens = t.burst()
+		c.throttles[identifier] = t
+	}
+	c.throttleMutex.Unlock()
+
+	if pending != nil {
+		c.sendThrottled(identifier, pending)
+	}
+}
+
+func (c *Client) EventThrottleStats(identifier string) ThrottleStats {
+	c.throttleMutex.Lock()
+	defer c.throttleMutex.Unlock()
+	t, ok := c.throttles[identifier]
+	if ok == false {
+		return ThrottleStats{}
+	}
+	return t.stats
+}
+
+// throttleEvent returns true if the event can be sent right away.
+func (c *Client) throttleEvent(identifier string, data rotonde.Object) bool {
+	c.throttleMutex.Lock()
+	defer c.throttleMutex.Unlock()
+	t, ok := c.throttles[identifier]
+	if ok == false {
+		return true
+	}
+	t.refill(time.Now())
+	if t.pending == nil && t.tokens >= 1 {
+		t.tokens--
+		t.stats.Sent++
+		return true
+	}
+	if t.config.Coalesce == false {
+		t.stats.Dropped++
+		return false
+	}
+	if t.pending != nil {
+		t.stats.Coalesced++
+	}
+	t.pending = data
+	if t.timer == nil {
+		wait := time.Duration((1 - t.tokens) / t.config.Rate * float64(time.Second))
+		t.timer = time.AfterFunc(wait, func() {
+			c.flushThrottle(identifier, t)
+		})
+	}
+	return false
+}
+
+func (c *Client) flushThrottle(identifier string, t *throttle) {
+	c.throttleMutex.Lock()
+	t.timer = nil
+	if c.throttles[identifier] != t || t.pending == nil {
+		c.throttleMutex.Unlock()
+		return
+	}
+	t.refill(time.Now())
+	t.tokens--
+	data := t.pending
+	t.pending = nil
+	t.stats.Sent++
+	c.throttleMutex.Unlock()
+
+	c.sendThrottled(identifier, data)
+}
+
+// sendThrottled sends an event held back by a throttle, giving up if the
+// client is closed.
+func (c *Client) sendThrottled(identifier string, data rotonde.Object) {
+	select {
+	case c.jsonInChan <- rotonde.Event{identifier, data}:
+	case <-c.ctx.Done():
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func TestThrottleRate(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	events := c.EventsChan(context.Background(), "temp", 100)
+
+	c.SetEventThrottle("temp", ThrottleConfig{Rate: 10, Burst: 2})
+	sendValues(c, "temp", 1, 2, 3, 4, 5)
+	expectValues(t, published(t, events, 2), 1, 2)
+	if stats := c.EventThrottleStats("temp"); stats.Sent != 2 || stats.Dropped != 3 {
+		t.Fatal("unexpected stats ", stats)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	sendValues(c, "temp", 6)
+	expectValues(t, published(t, events, 1), 6)
+	select {
+	case event := <-events:
+		t.Fatal("unexpected event ", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestThrottleCoalesce(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	events := c.EventsChan(context.Background(), "temp", 100)
+
+	c.SetEventThrottle("temp", ThrottleConfig{Rate: 10, Burst: 1, Coalesce: true})
+	start := time.Now()
+	sendValues(c, "temp", 1, 2, 3)
+	expectValues(t, published(t, events, 2), 1, 3)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatal("coalesced event sent after ", elapsed)
+	}
+	if stats := c.EventThrottleStats("temp"); stats.Sent != 2 || stats.Coalesced != 1 || stats.Dropped != 0 {
+		t.Fatal("unexpected stats ", stats)
+	}
+}
+
+func TestThrottleReplaceFlushesPending(t *testing.T) {
+	c := newLoopbackClient(t)
+	defer c.Close()
+	events := c.EventsChan(context.Background(), "temp", 100)
+
+	c.SetEventThrottle("temp", ThrottleConfig{Rate: 0.1, Coalesce: true})
+	sendValues(c, "temp", 1, 2)
+	expectValues(t, published(t, events, 1), 1)
+	c.SetEventThrottle("temp", ThrottleConfig{})
+	select {
+	case event := <-events:
+		expectValues(t, []float64{valueOf(event.Data)}, 2)
+	case <-time.After(time.Second):
+		t.Fatal("pending event not sent when the throttle was removed")
+	}
+}
+
+func TestThrottleFlushAfterClose(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	c.Close()
+	for len(c.jsonInChan) < cap(c.jsonInChan) {
+		c.jsonInChan <- nil
+	}
+
+	done := make(chan bool)
+	go func() {
+		c.throttleMutex.Lock()
+		pending := &throttle{config: ThrottleConfig{Rate: 1000}, last: time.Now(), pending: rotonde.Object{"value": 1.0}}
+		c.throttles["temp"] = pending
+		c.throttleMutex.Unlock()
+		c.flushThrottle("temp", pending)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("flushing a throttle blocked after Close")
+	}
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// SpanContext identifies a span, it travels in the traceparent header of
+// the metadata envelope, in the W3C Trace Context format.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+func (s SpanContext) IsValid() bool {
+	return s.TraceID != [16]byte{} && s.SpanID != [8]byte{}
+}
+
+func (s SpanContext) TraceParent() string {
+	flags := 0
+	if s.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%x-%x-%02x", s.TraceID, s.SpanID, flags)
+}
+
+func ParseTraceParent(traceParent string) (s SpanContext, err error) {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return s, errors.New(fmt.Sprint("invalid traceparent ", traceParent))
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return s, errors.New(fmt.Sprint("invalid traceparent ", traceParent))
+	}
+	// the fields are lowercase hex, which hex.Decode does not enforce
+	for _, part := range parts[:4] {
+		if strings.Trim(part, "0123456789abcdef") != "" {
+			return s, errors.New(fmt.Sprint("invalid traceparent ", traceParent))
+		}
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(s.TraceID[:], []byte(parts[1])); err != nil {
+		return s, err
+	}
+	if _, err := hex.Decode(s.SpanID[:], []byte(parts[2])); err != nil {
+		return s, err
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return s, err
+	}
+	s.Sampled = flags[0]&1 == 1
+	if s.IsValid() == false {
+		return SpanContext{}, errors.New(fmt.Sprint("invalid traceparent ", traceParent))
+	}
+	return s, nil
+}
+
+type spanContextKey struct{}
+
+func ContextWithSpanContext(ctx context.Context, s SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	s, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return s, ok && s.IsValid()
+}
+
+type Span interface {
+	Context() SpanContext
+	End()
+}
+
+// Tracer starts spans, the parent of a span being the span context carried
+// by ctx. The returned context carries the new span.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// WithTracer records the spans of sent and received messages, and of their
+// handlers. Without tracer, incoming trace contexts are still propagated.
+func WithTracer(tracer Tracer) Option {
+	return func(c *Client) {
+		c.tracer = tracer
+	}
+}
+
+type nopSpan struct {
+	context SpanContext
+}
+
+func (s nopSpan) Context() SpanContext { return s.context }
+func (s nopSpan) End()                 {}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := SpanContextFromContext(ctx)
+	return ctx, nopSpan{parent}
+}
+
+func newSpanContext(parent SpanContext) SpanContext {
+	s := SpanContext{TraceID: parent.TraceID, Sampled: true}
+	if parent.IsValid() {
+		s.Sampled = parent.Sampled
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	rand.Read(s.SpanID[:])
+	return s
+}
+
+// RecordedSpan is a span ended on a MemoryTracer.
+type RecordedSpan struct {
+	Name    string
+	Context SpanContext
+	Parent  SpanContext
+	Start   time.Time
+	End     time.Time
+}
+
+// MemoryTracer keeps the ended spans in memory, for tests.
+type MemoryTracer struct {
+	mutex *sync.Mutex
+	spans []RecordedSpan
+}
+
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{mutex: &sync.Mutex{}}
+}
+
+func (t *MemoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := SpanContextFromContext(ctx)
+	s := &memorySpan{t: t, span: RecordedSpan{name, newSpanContext(parent), parent, time.Now(), time.Time{}}}
+	return ContextWithSpanContext(ctx, s.span.Context), s
+}
+
+// Spans returns the ended spans, in the order they ended.
+func (t *MemoryTracer) Spans() []RecordedSpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]RecordedSpan(nil), t.spans...)
+}
+
+func (t *MemoryTracer) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.spans = nil
+}
+
+type memorySpan struct {
+	t     *MemoryTracer
+	span  RecordedSpan
+	ended bool
+}
+
+func (s *memorySpan) Context() SpanContext { return s.span.Context }
+
+func (s *memorySpan) End() {
+	s.t.mutex.Lock()
+	defer s.t.mutex.Unlock()
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.span.End = time.Now()
+	s.t.spans = append(s.t.spans, s.span)
+}
+
+func traceHeaders(span Span) map[string]string {
+	if span.Context().IsValid() == false {
+		return nil
+	}
+	return map[string]string{"traceparent": span.Context().TraceParent()}
+}
+
+// startHandlerSpan extracts the trace context of a received message, records
+// its reception and starts the span of its handler.
+func (c *Client) startHandlerSpan(ctx context.Context, identifier string, data rotonde.Object) (context.Context, Span) {
+	if metadata, ok := GetMetadata(data); ok {
+		if parent, err := ParseTraceParent(metadata.Headers["traceparent"]); err == nil {
+			ctx = ContextWithSpanContext(ctx, parent)
+		}
+	}
+	ctx, receive := c.tracer.Start(ctx, "receive "+identifier)
+	receive.End()
+	return c.tracer.Start(ctx, "handle "+identifier)
+}
+
+// OnNamedEventContext is OnNamedEvent with a context carrying the trace
+// context of the event.
+func (c *Client) OnNamedEventContext(identifier string, fn func(ctx context.Context, event rotonde.Event) bool) {
+	c.OnNamedEvent(identifier, func(m interface{}) bool {
+		event := m.(rotonde.Event)
+		ctx, span := c.startHandlerSpan(c.ctx, identifier, event.Data)
+		defer span.End()
+		return fn(ctx, event)
+	})
+}
+
+// OnNamedActionContext is OnNamedAction with a context carrying the trace
+// context of the action.
+func (c *Client) OnNamedActionContext(identifier string, fn func(ctx context.Context, action rotonde.Action) bool) {
+	c.OnNamedAction(identifier, func(m interface{}) bool {
+		action := m.(rotonde.Action)
+		ctx, span := c.startHandlerSpan(c.ctx, identifier, action.Data)
+		defer span.End()
+		return fn(ctx, action)
+	})
+}
@@ -0,0 +1,60 @@
+package client
+
+import "testing"
+
+func TestParseTraceParent(t *testing.T) {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	s, err := ParseTraceParent(traceParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Sampled == false || s.TraceID[0] != 0x4b || s.SpanID[7] != 0xb7 {
+		t.Fatal("unexpected span context ", s)
+	}
+	if s.TraceParent() != traceParent {
+		t.Fatal(s.TraceParent(), " does not round-trip ", traceParent)
+	}
+
+	s, err = ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	if err != nil || s.Sampled {
+		t.Fatal("unsampled traceparent parsed as ", s, err)
+	}
+	// later versions may append fields
+	if _, err := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTraceParentErrors(t *testing.T) {
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b-01",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00F067AA0BA902B7-01",
+		"0A-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"zz-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	}
+	for _, traceParent := range invalid {
+		if _, err := ParseTraceParent(traceParent); err == nil {
+			t.Errorf("%q should not parse", traceParent)
+		}
+	}
+}
+
+func TestNewSpanContext(t *testing.T) {
+	parent := newSpanContext(SpanContext{})
+	if parent.IsValid() == false {
+		t.Fatal("root span context is invalid")
+	}
+	child := newSpanContext(parent)
+	if child.TraceID != parent.TraceID || child.SpanID == parent.SpanID {
+		t.Fatal("child ", child, " does not continue the trace of ", parent)
+	}
+}
@@ -0,0 +1,288 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// A device twin is a document of desired and reported fields. Consumers
+// write the desired fields with the <device>_twin_desired job, the device
+// broadcasts the document on the <device>_twin event after each change, and
+// the <device>_twin_get action asks for a broadcast.
+
+func TwinIdentifier(device string) string {
+	return device + "_twin"
+}
+
+func TwinDesiredIdentifier(device string) string {
+	return device + "_twin_desired"
+}
+
+func TwinGetIdentifier(device string) string {
+	return device + "_twin_get"
+}
+
+// ErrStaleVersion rejects desired fields based on an outdated document.
+var ErrStaleVersion = errors.New("stale twin version")
+
+// TwinDocument versions are incremented on each change of their fields.
+// Epoch identifies the DeviceTwin the document comes from, versions start
+// over from 0 when the device restarts with a new epoch.
+type TwinDocument struct {
+	Epoch           string
+	Desired         rotonde.Object
+	DesiredVersion  uint64
+	Reported        rotonde.Object
+	ReportedVersion uint64
+}
+
+// Delta returns the desired fields whose reported value differs.
+func (d TwinDocument) Delta() rotonde.Object {
+	delta := rotonde.Object{}
+	for key, value := range d.Desired {
+		if reported, ok := d.Reported[key]; ok == false || valuesEqual(value, reported) == false {
+			delta[key] = value
+		}
+	}
+	return delta
+}
+
+func valuesEqual(a, b interface{}) bool {
+	fa, aIsNumber := toFloat(a)
+	fb, bIsNumber := toFloat(b)
+	if aIsNumber && bIsNumber {
+		return fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (d TwinDocument) copy() TwinDocument {
+	return TwinDocument{d.Epoch, copyObject(d.Desired), d.DesiredVersion, copyObject(d.Reported), d.ReportedVersion}
+}
+
+func (d TwinDocument) toObject() rotonde.Object {
+	return rotonde.Object{
+		"epoch":            d.Epoch,
+		"desired":          map[string]interface{}(copyObject(d.Desired)),
+		"desired_version":  d.DesiredVersion,
+		"reported":         map[string]interface{}(copyObject(d.Reported)),
+		"reported_version": d.ReportedVersion,
+	}
+}
+
+func twinDocumentFromObject(data rotonde.Object) TwinDocument {
+	d := TwinDocument{Desired: rotonde.Object{}, Reported: rotonde.Object{}}
+	d.Epoch, _ = data["epoch"].(string)
+	if desired, ok := data["desired"].(map[string]interface{}); ok {
+		d.Desired = copyObject(desired)
+	}
+	if reported, ok := data["reported"].(map[string]interface{}); ok {
+		d.Reported = copyObject(reported)
+	}
+	desiredVersion, _ := toFloat(data["desired_version"])
+	reportedVersion, _ := toFloat(data["reported_version"])
+	d.DesiredVersion, d.ReportedVersion = uint64(desiredVersion), uint64(reportedVersion)
+	return d
+}
+
+var twinFields = rotonde.FieldDefinitions{
+	&rotonde.FieldDefinition{"epoch", "string", ""},
+	&rotonde.FieldDefinition{"desired", "", ""},
+	&rotonde.FieldDefinition{"desired_version", "number", ""},
+	&rotonde.FieldDefinition{"reported", "", ""},
+	&rotonde.FieldDefinition{"reported_version", "number", ""},
+}
+
+// ReconcileFunc drives the device toward the desired fields of delta and
+// reports the new state with DeviceTwin.Report. ctx is canceled when the
+// desired fields change again.
+type ReconcileFunc func(ctx context.Context, delta rotonde.Object, twin *DeviceTwin)
+
+// DeviceTwin is the device side of a twin.
+type DeviceTwin struct {
+	c         *Client
+	device    string
+	reconcile ReconcileFunc
+
+	mutex           *sync.Mutex
+	document        TwinDocument
+	cancelReconcile context.CancelFunc
+	trigger         chan bool
+}
+
+// DeviceTwin declares the twin of device. reconcile runs whenever the
+// delta is not empty after a change of the desired fields, and again after
+// every reconnection.
+func (c *Client) DeviceTwin(device string, reconcile ReconcileFunc) *DeviceTwin {
+	t := &DeviceTwin{
+		c:         c,
+		device:    device,
+		reconcile: reconcile,
+		mutex:     &sync.Mutex{},
+		document:  TwinDocument{Epoch: newMessageID(), Desired: rotonde.Object{}, Reported: rotonde.Object{}},
+		trigger:   make(chan bool, 1),
+	}
+
+	c.AddLocalDefinition(&rotonde.Definition{TwinIdentifier(device), "event", false, twinFields})
+	c.AddLocalDefinition(&rotonde.Definition{TwinDesiredIdentifier(device), "action", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"desired", "", ""},
+		&rotonde.FieldDefinition{"version", "number", ""},
+	}})
+	c.AddLocalDefinition(&rotonde.Definition{TwinGetIdentifier(device), "action", false, rotonde.FieldDefinitions{}})
+
+	c.OnNamedJob(TwinDesiredIdentifier(device), func(ctx context.Context, action rotonde.Action, progress ProgressFunc) error {
+		desired, _ := action.Data["desired"].(map[string]interface{})
+		version, _ := toFloat(action.Data["version"])
+		return t.setDesired(ctx, desired, uint64(version))
+	})
+	c.OnNamedAction(TwinGetIdentifier(device), func(m interface{}) bool {
+		t.broadcast(context.Background())
+		return true
+	})
+	c.OnStateChange(func(state State) {
+		if state == Connected {
+			go t.broadcast(context.Background())
+			t.triggerReconcile()
+		}
+	})
+
+	go t.reconcileLoop()
+	return t
+}
+
+// Document returns a copy of the twin document.
+func (t *DeviceTwin) Document() TwinDocument {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.document.copy()
+}
+
+// Report merges fields into the reported state, a nil value removes its
+// field.
+func (t *DeviceTwin) Report(fields rotonde.Object) {
+	t.mutex.Lock()
+	mergeFields(t.document.Reported, fields)
+	t.document.ReportedVersion++
+	t.mutex.Unlock()
+	t.broadcast(context.Background())
+}
+
+func (t *DeviceTwin) setDesired(ctx context.Context, desired rotonde.Object, version uint64) error {
+	t.mutex.Lock()
+	if version != t.document.DesiredVersion {
+		t.mutex.Unlock()
+		return ErrStaleVersion
+	}
+	mergeFields(t.document.Desired, desired)
+	t.document.DesiredVersion++
+	if t.cancelReconcile != nil {
+		t.cancelReconcile()
+	}
+	t.mutex.Unlock()
+
+	t.broadcast(ctx)
+	t.triggerReconcile()
+	return nil
+}
+
+func (t *DeviceTwin) broadcast(ctx context.Context) {
+	t.c.SendEventContext(ctx, TwinIdentifier(t.device), t.Document().toObject())
+}
+
+func (t *DeviceTwin) triggerReconcile() {
+	select {
+	case t.trigger <- true:
+	default:
+	}
+}
+
+func (t *DeviceTwin) reconcileLoop() {
+	for {
+		select {
+		case <-t.c.ctx.Done():
+			return
+		case <-t.trigger:
+		}
+
+		delta := t.Document().Delta()
+		if len(delta) == 0 {
+			continue
+		}
+		ctx, cancel := context.WithCancel(t.c.ctx)
+		t.mutex.Lock()
+		t.cancelReconcile = cancel
+		t.mutex.Unlock()
+		t.reconcile(ctx, delta, t)
+		cancel()
+	}
+}
+
+func mergeFields(document, fields rotonde.Object) {
+	for key, value := range fields {
+		if value == nil {
+			delete(document, key)
+		} else {
+			document[key] = value
+		}
+	}
+}
+
+// RemoteTwin mirrors the twin of a device.
+type RemoteTwin struct {
+	c      *Client
+	device string
+
+	mutex    *sync.Mutex
+	document TwinDocument
+	known    bool
+}
+
+// RemoteTwin follows the twin of device, the document is requested right
+// away and after each reconnection. Documents older than the known one are
+// ignored, unless they come from a new epoch of the device.
+func (c *Client) RemoteTwin(device string) *RemoteTwin {
+	r := &RemoteTwin{c: c, device: device, mutex: &sync.Mutex{}}
+	c.OnNamedEvent(TwinIdentifier(device), func(m interface{}) bool {
+		document := twinDocumentFromObject(m.(rotonde.Event).Data)
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		stale := document.DesiredVersion < r.document.DesiredVersion || document.ReportedVersion < r.document.ReportedVersion
+		if r.known && document.Epoch == r.document.Epoch && stale {
+			return true
+		}
+		r.document = document
+		r.known = true
+		return true
+	})
+	c.OnStateChange(func(state State) {
+		if state == Connected {
+			go c.SendAction(TwinGetIdentifier(device), rotonde.Object{})
+		}
+	})
+	c.SendAction(TwinGetIdentifier(device), rotonde.Object{})
+	return r
+}
+
+// Document returns a copy of the latest known document, ok is false until
+// a document is received.
+func (r *RemoteTwin) Document() (document TwinDocument, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.document.copy(), r.known
+}
+
+// SetDesired merges fields into the desired state of a document at
+// version, a nil value removes its field. It returns ErrStaleVersion when
+// the desired state changed since version.
+func (r *RemoteTwin) SetDesired(ctx context.Context, fields rotonde.Object, version uint64) error {
+	data := rotonde.Object{"desired": map[string]interface{}(copyObject(fields)), "version": version}
+	err := r.c.StartJob(ctx, TwinDesiredIdentifier(r.device), data).Wait(ctx)
+	if err != nil && err.Error() == ErrStaleVersion.Error() {
+		return ErrStaleVersion
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func waitDocument(t *testing.T, r *RemoteTwin, match func(TwinDocument) bool) TwinDocument {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		document, ok := r.Document()
+		if ok && match(document) {
+			return document
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("unexpected document ", document)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTwin(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+	loopback(t, c)
+	device := c.DeviceTwin("lamp", func(ctx context.Context, delta rotonde.Object, twin *DeviceTwin) {
+		twin.Report(delta)
+	})
+	r := c.RemoteTwin("lamp")
+	waitDocument(t, r, func(TwinDocument) bool { return true })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := r.SetDesired(ctx, rotonde.Object{"on": true}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetDesired(ctx, rotonde.Object{"on": false}, 0); err != ErrStaleVersion {
+		t.Fatal("SetDesired on an outdated version returned ", err)
+	}
+	document := waitDocument(t, r, func(document TwinDocument) bool {
+		return document.Reported["on"] == true
+	})
+	if document.Epoch != device.Document().Epoch || document.DesiredVersion != 1 || len(document.Delta()) != 0 {
+		t.Fatal("unexpected document ", document)
+	}
+}
+
+func TestRemoteTwinFollowsRestartedDevice(t *testing.T) {
+	c := NewClient("ws://127.0.0.1:0", WithLogger(NopLogger()))
+	defer c.Close()
+	r := c.RemoteTwin("lamp")
+	// called after the handler of r
+	received := make(chan bool, 10)
+	c.OnNamedEvent(TwinIdentifier("lamp"), func(m interface{}) bool {
+		received <- true
+		return true
+	})
+	send := func(document TwinDocument) {
+		c.dispatcher.dispatch(rotonde.Event{TwinIdentifier("lamp"), document.toObject()})
+		<-received
+	}
+
+	send(TwinDocument{"before", rotonde.Object{"on": true}, 3, rotonde.Object{"on": true}, 2})
+	send(TwinDocument{"before", rotonde.Object{}, 1, rotonde.Object{}, 1})
+	if document, _ := r.Document(); document.DesiredVersion != 3 {
+		t.Fatal("outdated document not ignored ", document)
+	}
+	send(TwinDocument{"after", rotonde.Object{}, 0, rotonde.Object{"on": false}, 1})
+	document := waitDocument(t, r, func(document TwinDocument) bool { return document.Epoch == "after" })
+	if document.DesiredVersion != 0 || document.Reported["on"] != false {
+		t.Fatal("unexpected document ", document)
+	}
+}
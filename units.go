@@ -0,0 +1,345 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+// dimension holds the exponents of length, mass, time, current,
+// temperature, amount of substance, luminous intensity and angle.
+type dimension [8]int
+
+func (d dimension) add(o dimension, n int) dimension {
+	for i := range d {
+		d[i] += o[i] * n
+	}
+	return d
+}
+
+var (
+	dimensionless = dimension{}
+	dimLength     = dimension{1, 0, 0, 0, 0, 0, 0, 0}
+	dimMass       = dimension{0, 1, 0, 0, 0, 0, 0, 0}
+	dimTime       = dimension{0, 0, 1, 0, 0, 0, 0, 0}
+	dimCurrent    = dimension{0, 0, 0, 1, 0, 0, 0, 0}
+	dimTemp       = dimension{0, 0, 0, 0, 1, 0, 0, 0}
+	dimAmount     = dimension{0, 0, 0, 0, 0, 1, 0, 0}
+	dimLuminous   = dimension{0, 0, 0, 0, 0, 0, 1, 0}
+	dimAngle      = dimension{0, 0, 0, 0, 0, 0, 0, 1}
+)
+
+// Unit converts values to and from the SI base units of its dimension:
+// si = value * factor + offset.
+type Unit struct {
+	Symbol string
+	dim    dimension
+	factor float64
+	offset float64
+}
+
+func (u Unit) Compatible(o Unit) bool {
+	return u.dim == o.dim
+}
+
+func (u Unit) toBase(value float64) float64 {
+	return value*u.factor + u.offset
+}
+
+func (u Unit) fromBase(value float64) float64 {
+	return (value - u.offset) / u.factor
+}
+
+var unitsMutex = &sync.Mutex{}
+var units = map[string]Unit{}
+
+var siPrefixes = map[string]float64{
+	"G": 1e9,
+	"M": 1e6,
+	"k": 1e3,
+	"h": 1e2,
+	"c": 1e-2,
+	"m": 1e-3,
+	"u": 1e-6,
+	"µ": 1e-6,
+	"n": 1e-9,
+}
+
+// prefixable lists the symbols accepting SI prefixes, km or mA for example.
+var prefixable = map[string]bool{}
+
+func registerUnit(symbol string, dim dimension, factor, offset float64, prefix bool) {
+	units[symbol] = Unit{symbol, dim, factor, offset}
+	if prefix {
+		prefixable[symbol] = true
+	}
+}
+
+func init() {
+	registerUnit("", dimensionless, 1, 0, false)
+	registerUnit("1", dimensionless, 1, 0, false)
+	registerUnit("%", dimensionless, 0.01, 0, false)
+	registerUnit("ppm", dimensionless, 1e-6, 0, false)
+
+	registerUnit("m", dimLength, 1, 0, true)
+	registerUnit("in", dimLength, 0.0254, 0, false)
+	registerUnit("ft", dimLength, 0.3048, 0, false)
+	registerUnit("mi", dimLength, 1609.344, 0, false)
+
+	registerUnit("g", dimMass, 1e-3, 0, true)
+	registerUnit("lb", dimMass, 0.45359237, 0, false)
+
+	registerUnit("s", dimTime, 1, 0, true)
+	registerUnit("min", dimTime, 60, 0, false)
+	registerUnit("h", dimTime, 3600, 0, false)
+
+	registerUnit("A", dimCurrent, 1, 0, true)
+	registerUnit("mol", dimAmount, 1, 0, true)
+	registerUnit("cd", dimLuminous, 1, 0, false)
+
+	registerUnit("K", dimTemp, 1, 0, false)
+	registerUnit("°C", dimTemp, 1, 273.15, false)
+	registerUnit("C", dimTemp, 1, 273.15, false)
+	registerUnit("°F", dimTemp, 5.0/9.0, 273.15-32*5.0/9.0, false)
+	registerUnit("F", dimTemp, 5.0/9.0, 273.15-32*5.0/9.0, false)
+
+	registerUnit("rad", dimAngle, 1, 0, false)
+	registerUnit("deg", dimAngle, 0.017453292519943295, 0, false)
+	registerUnit("°", dimAngle, 0.017453292519943295, 0, false)
+
+	hertz := dimensionless.add(dimTime, -1)
+	newton := dimMass.add(dimLength, 1).add(dimTime, -2)
+	pascal := newton.add(dimLength, -2)
+	joule := newton.add(dimLength, 1)
+	watt := joule.add(dimTime, -1)
+	volt := watt.add(dimCurrent, -1)
+	registerUnit("Hz", hertz, 1, 0, true)
+	registerUnit("rpm", hertz, 1.0/60, 0, false)
+	registerUnit("N", newton, 1, 0, true)
+	registerUnit("Pa", pascal, 1, 0, true)
+	registerUnit("bar", pascal, 1e5, 0, true)
+	registerUnit("psi", pascal, 6894.757293168, 0, false)
+	registerUnit("J", joule, 1, 0, true)
+	registerUnit("Wh", joule, 3600, 0, true)
+	registerUnit("W", watt, 1, 0, true)
+	registerUnit("V", volt, 1, 0, true)
+	registerUnit("Ohm", volt.add(dimCurrent, -1), 1, 0, true)
+	registerUnit("Ω", volt.add(dimCurrent, -1), 1, 0, true)
+	registerUnit("L", dimLength.add(dimLength, 2), 1e-3, 0, true)
+	registerUnit("lx", dimLuminous.add(dimLength, -2), 1, 0, false)
+
+	registerUnit("mph", dimLength.add(dimTime, -1), 0.44704, 0, false)
+	registerUnit("kn", dimLength.add(dimTime, -1), 1852.0/3600, 0, false)
+}
+
+// RegisterUnit declares symbol as factor times the unit expression base,
+// plus offset, RegisterUnit("kph", "km/h", 1, 0) for example.
+func RegisterUnit(symbol string, base string, factor, offset float64) error {
+	u, err := ParseUnit(base)
+	if err != nil {
+		return err
+	}
+	unitsMutex.Lock()
+	defer unitsMutex.Unlock()
+	units[symbol] = Unit{symbol, u.dim, u.factor * factor, u.offset + offset*u.factor}
+	return nil
+}
+
+func lookupUnit(symbol string) (Unit, bool) {
+	unitsMutex.Lock()
+	defer unitsMutex.Unlock()
+	if u, ok := units[symbol]; ok {
+		return u, true
+	}
+	for prefix, factor := range siPrefixes {
+		if strings.HasPrefix(symbol, prefix) == false {
+			continue
+		}
+		base := strings.TrimPrefix(symbol, prefix)
+		if prefixable[base] == false {
+			continue
+		}
+		u := units[base]
+		return Unit{symbol, u.dim, u.factor * factor, 0}, true
+	}
+	return Unit{}, false
+}
+
+var superscripts = strings.NewReplacer("²", "^2", "³", "^3")
+
+// ParseUnit parses unit expressions made of registered symbols, products
+// with '*' or '.', quotients with '/', and integer exponents: "m/s^2",
+// "kW.h" or "km/h".
+func ParseUnit(s string) (Unit, error) {
+	s = strings.TrimSpace(s)
+	if u, ok := lookupUnit(s); ok {
+		return u, nil
+	}
+
+	expr := superscripts.Replace(strings.Replace(s, " ", "", -1))
+	u := Unit{s, dimensionless, 1, 0}
+	for i, part := range strings.Split(expr, "/") {
+		sign := 1
+		if i > 0 {
+			sign = -1
+		}
+		for _, term := range strings.FieldsFunc(part, func(r rune) bool { return r == '*' || r == '.' || r == '·' }) {
+			symbol, exponent, err := splitExponent(term)
+			if err != nil {
+				return Unit{}, errors.New(fmt.Sprint("invalid unit ", s, ": ", err))
+			}
+			t, ok := lookupUnit(symbol)
+			if ok == false {
+				return Unit{}, errors.New(fmt.Sprint("unknown unit ", symbol, " in ", s))
+			}
+			if t.offset != 0 {
+				return Unit{}, errors.New(fmt.Sprint(symbol, " cannot be combined in ", s))
+			}
+			for n := 0; n < exponent; n++ {
+				if sign > 0 {
+					u.factor *= t.factor
+				} else {
+					u.factor /= t.factor
+				}
+			}
+			u.dim = u.dim.add(t.dim, sign*exponent)
+		}
+	}
+	return u, nil
+}
+
+func splitExponent(term string) (string, int, error) {
+	if i := strings.Index(term, "^"); i >= 0 {
+		n, err := strconv.Atoi(term[i+1:])
+		if err != nil || n < 1 {
+			return "", 0, errors.New(fmt.Sprint("bad exponent in ", term))
+		}
+		return term[:i], n, nil
+	}
+	end := len(term)
+	for end > 0 && unicode.IsDigit(rune(term[end-1])) {
+		end--
+	}
+	if end == len(term) || end == 0 {
+		return term, 1, nil
+	}
+	n, err := strconv.Atoi(term[end:])
+	if err != nil || n < 1 {
+		return "", 0, errors.New(fmt.Sprint("bad exponent in ", term))
+	}
+	return term[:end], n, nil
+}
+
+// ConvertUnits converts value from one unit to another, both must have the
+// same dimension.
+func ConvertUnits(value float64, from, to string) (float64, error) {
+	f, err := ParseUnit(from)
+	if err != nil {
+		return 0, err
+	}
+	t, err := ParseUnit(to)
+	if err != nil {
+		return 0, err
+	}
+	if f.Compatible(t) == false {
+		return 0, errors.New(fmt.Sprint("cannot convert ", from, " to ", to))
+	}
+	return t.fromBase(f.toBase(value)), nil
+}
+
+// ValidateUnits checks that the units of all the number fields of d can be parsed.
+func ValidateUnits(d *rotonde.Definition) error {
+	for _, field := range d.Fields {
+		if field == nil || field.Type != "number" {
+			continue
+		}
+		if _, err := ParseUnit(field.Units); err != nil {
+			return errors.New(fmt.Sprint(d.Identifier, ".", field.Name, ": ", err))
+		}
+	}
+	return nil
+}
+
+// Values gives typed access to the data of an event or action, number
+// fields are converted using the units of their definition.
+type Values struct {
+	Data   rotonde.Object
+	Fields rotonde.FieldDefinitions
+}
+
+// EventValues looks up the remote definition of the event for its units.
+func (c *Client) EventValues(event rotonde.Event) *Values {
+	v := &Values{Data: event.Data}
+	if definition, err := c.GetRemoteDefinition("event", event.Identifier); err == nil {
+		v.Fields = definition.Fields
+	}
+	return v
+}
+
+// ActionValues looks up the local definition of the action for its units.
+func (c *Client) ActionValues(action rotonde.Action) *Values {
+	v := &Values{Data: action.Data}
+	if definition, err := c.getLocalDefinition("action", action.Identifier); err == nil {
+		v.Fields = definition.Fields
+	}
+	return v
+}
+
+func (v *Values) get(field string) (interface{}, error) {
+	value, ok := v.Data[field]
+	if ok == false {
+		return nil, errors.New(fmt.Sprint(field, " Not found"))
+	}
+	return value, nil
+}
+
+// GetFloat returns the number field converted to unit, an empty unit
+// returns the value as received.
+func (v *Values) GetFloat(field string, unit string) (float64, error) {
+	value, err := v.get(field)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := toFloat(value)
+	if ok == false {
+		return 0, errors.New(fmt.Sprint(field, " is not a number"))
+	}
+	if unit == "" {
+		return f, nil
+	}
+	for _, definition := range v.Fields {
+		if definition.Name == field {
+			return ConvertUnits(f, definition.Units, unit)
+		}
+	}
+	return 0, errors.New(fmt.Sprint(field, " has no known units"))
+}
+
+func (v *Values) GetString(field string) (string, error) {
+	value, err := v.get(field)
+	if err != nil {
+		return "", err
+	}
+	s, ok := value.(string)
+	if ok == false {
+		return "", errors.New(fmt.Sprint(field, " is not a string"))
+	}
+	return s, nil
+}
+
+func (v *Values) GetBool(field string) (bool, error) {
+	value, err := v.get(field)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if ok == false {
+		return false, errors.New(fmt.Sprint(field, " is not a boolean"))
+	}
+	return b, nil
+}
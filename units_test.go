@@ -0,0 +1,91 @@
+package client
+
+import (
+	"math"
+	"testing"
+
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+func TestConvertUnits(t *testing.T) {
+	conversions := []struct {
+		value    float64
+		from, to string
+		expected float64
+	}{
+		{1, "km", "m", 1000},
+		{100, "°C", "°F", 212},
+		{32, "F", "K", 273.15},
+		{36, "km/h", "m/s", 10},
+		{1, "kW.h", "J", 3.6e6},
+		{1, "kWh", "Wh", 1000},
+		{2, "m²", "cm^2", 20000},
+		{1, "m3", "L", 1000},
+		{9.81, "m/s^2", "m/s/s", 9.81},
+		{50, "%", "1", 0.5},
+		{1, "bar", "kPa", 100},
+	}
+	for _, c := range conversions {
+		value, err := ConvertUnits(c.value, c.from, c.to)
+		if err != nil {
+			t.Errorf("%v %v to %v: %v", c.value, c.from, c.to, err)
+			continue
+		}
+		if math.Abs(value-c.expected) > 1e-9*math.Max(1, math.Abs(c.expected)) {
+			t.Errorf("%v %v is %v %v, expected %v", c.value, c.from, value, c.to, c.expected)
+		}
+	}
+}
+
+func TestConvertUnitsErrors(t *testing.T) {
+	conversions := []struct{ from, to string }{
+		{"m", "s"},
+		{"km/h", "m"},
+		{"parsec", "m"},
+		{"m^x", "m"},
+		{"°C/s", "K/s"},
+	}
+	for _, c := range conversions {
+		if _, err := ConvertUnits(1, c.from, c.to); err == nil {
+			t.Errorf("converting %v to %v should fail", c.from, c.to)
+		}
+	}
+	for _, unit := range []string{"m^0", "m0", "km/h00"} {
+		if _, err := ParseUnit(unit); err == nil {
+			t.Errorf("%v should not parse", unit)
+		}
+	}
+}
+
+func TestRegisterUnit(t *testing.T) {
+	if err := RegisterUnit("kph", "km/h", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	value, err := ConvertUnits(36, "kph", "m/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(value-10) > 1e-9 {
+		t.Fatal("36 kph is ", value, " m/s, expected 10")
+	}
+	if err := RegisterUnit("furlong", "lightyear", 1, 0); err == nil {
+		t.Fatal("registering a unit on an unknown base should fail")
+	}
+}
+
+func TestValidateUnits(t *testing.T) {
+	valid := &rotonde.Definition{"temp", "event", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"value", "number", "°C"},
+		&rotonde.FieldDefinition{"label", "string", "whatever"},
+		nil,
+	}}
+	if err := ValidateUnits(valid); err != nil {
+		t.Fatal(err)
+	}
+	invalid := &rotonde.Definition{"temp", "event", false, rotonde.FieldDefinitions{
+		&rotonde.FieldDefinition{"value", "number", "degrees"},
+	}}
+	if err := ValidateUnits(invalid); err == nil {
+		t.Fatal("unknown unit should not validate")
+	}
+}
@@ -1,59 +1,146 @@
 package client
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/HackerLoop/rotonde/shared"
-	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/websocket"
 )
 
-func startConnection(rotondeUrl string, inChan, outChan chan interface{}) {
-	log.Info("startRotondeClient")
-	u, err := url.Parse(rotondeUrl)
-	if err != nil {
-		panic(err)
-	}
+func (c *Client) startConnection() {
+	c.logger.Info("starting rotonde client", nil)
 
+	index := 0
 	for {
-		conn, err := net.Dial("tcp", u.Host)
-		if err != nil {
-			log.Warning(err)
-			time.Sleep(2 * time.Second)
+		select {
+		case <-c.ctx.Done():
+			return
+		default:
+		}
+		endpoints := c.resolveEndpoints()
+		if index >= len(endpoints) {
+			// every endpoint failed, wait before the next round
+			index = 0
+			if sleepContext(c.ctx, 2*time.Second) == false {
+				return
+			}
 			continue
 		}
-		ws, response, err := websocket.NewClient(conn, u, http.Header{}, 10000, 10000)
+		endpoint := endpoints[index]
+
+		c.setState(Connecting)
+		ws, err := c.dial(endpoint)
 		if err != nil {
-			log.Warning(err)
-			log.Warning(response)
-			time.Sleep(2 * time.Second)
+			c.logger.Warn("connection failed", Fields{"endpoint": endpoint, "error": err})
+			c.setState(Disconnected)
+			index++
 			continue
 		}
-		processRotondePackets(ws, inChan, outChan)
+		c.setEndpoint(endpoint)
+		c.processRotondePackets(ws, endpoint, index > 0)
+		c.setEndpoint("")
+		c.setState(Disconnected)
+		index = 0
 	}
 }
 
-func processRotondePackets(conn *websocket.Conn, inChan, outChan chan interface{}) {
+// dialTimeout bounds both the TCP connection and the websocket handshake.
+const dialTimeout = 10 * time.Second
+
+// dial is aborted by Close.
+func (c *Client) dial(endpoint string) (*websocket.Conn, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(c.ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if len(c.codecs) > 0 {
+		header.Set("Sec-WebSocket-Protocol", c.subprotocols())
+	}
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	handshaken := make(chan bool)
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			conn.Close()
+		case <-handshaken:
+		}
+	}()
+	ws, response, err := websocket.NewClient(conn, u, header, 10000, 10000)
+	close(handshaken)
+	if err != nil {
+		conn.Close()
+		if response != nil {
+			return nil, errors.New(fmt.Sprint("websocket handshake failed: ", response.Status))
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ws, nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// processRotondePackets serves a connection until it is lost, if fallback
+// is set and the client prefers its primary endpoint, the connection is
+// closed as soon as the primary is reachable again.
+func (c *Client) processRotondePackets(conn *websocket.Conn, endpoint string, fallback bool) {
+	codec := c.selectCodec(conn.Subprotocol())
+	logger := withFields(c.logger, Fields{"connection": atomic.AddUint64(&c.connectionID, 1), "endpoint": endpoint, "codec": codec.Name()})
+	done := make(chan bool)
+	replay, session := c.replayPackets()
+	c.startHeartbeat(conn, done, logger)
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
+		for _, dispatcherPacket := range replay {
+			if c.writePacket(conn, codec, dispatcherPacket, logger) == false {
+				return
+			}
+		}
+
 		for {
 			select {
-			case dispatcherPacket := <-inChan:
-				jsonPacket, err := rotonde.ToJSON(dispatcherPacket)
-				if err != nil {
-					log.Warning(err)
+			case dispatcherPacket := <-c.jsonInChan:
+				switch p := dispatcherPacket.(type) {
+				case flushPacket:
+					close(p)
+					continue
+				case sessionPacket:
+					if p.session != session {
+						continue
+					}
+					dispatcherPacket = p.packet
 				}
-				if err := conn.WriteMessage(websocket.TextMessage, jsonPacket); err != nil {
-					log.Fatal(err)
+				if c.writePacket(conn, codec, dispatcherPacket, logger) == false {
 					return
 				}
+			case <-done:
+				return
 			}
 		}
 	}()
@@ -61,23 +148,93 @@ func processRotondePackets(conn *websocket.Conn, inChan, outChan chan interface{
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(done)
 
 		for {
 			messageType, reader, err := conn.NextReader()
 			if err != nil {
-				log.Fatal(err)
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					logger.Warn("heartbeat timeout, connection is dead", nil)
+				} else {
+					logger.Warn("connection lost", Fields{"error": err})
+				}
 				return
 			}
-			if messageType == websocket.TextMessage {
-				dispatcherPacket, err := rotonde.FromJSON(reader)
-				if err != nil {
-					log.Warning(err)
+			c.extendReadDeadline(conn)
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				logger.Warn("connection lost", Fields{"error": err})
+				return
+			}
+			// text frames are always JSON, binary ones use the negotiated codec
+			frameCodec := JSONCodec
+			if messageType == websocket.BinaryMessage {
+				frameCodec = codec
+			}
+			inbound, _, unknown := c.interceptors()
+			dispatcherPacket, err := frameCodec.Decode(data)
+			if err != nil || packetType(dispatcherPacket) == "" {
+				if len(unknown) == 0 {
+					logger.Warn("cannot decode packet", Fields{"error": err})
+				}
+				for _, fn := range unknown {
+					fn(messageType, data)
 				}
-				outChan <- dispatcherPacket
+				continue
 			}
+			intercept(inbound, dispatcherPacket, func(dispatcherPacket interface{}) {
+				if packetType(dispatcherPacket) == "" {
+					logger.Warn("interceptor produced an unknown packet", Fields{"packet": dispatcherPacket})
+					return
+				}
+				c.dispatcher.dispatch(dispatcherPacket)
+			})
+			// dispatch may have waited for slow handlers
+			c.extendReadDeadline(conn)
+		}
+	}()
+
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			conn.Close()
+		case <-done:
 		}
 	}()
 
-	log.Info("Treating messages")
+	if fallback && c.preferPrimary > 0 {
+		go c.watchPrimary(conn, done, logger)
+	}
+
+	logger.Info("connected", nil)
+	c.setState(Connected)
 	wg.Wait()
+	conn.Close()
+}
+
+// writePacket returns false when the connection is not usable anymore.
+func (c *Client) writePacket(conn *websocket.Conn, codec Codec, dispatcherPacket interface{}, logger Logger) bool {
+	_, outbound, _ := c.interceptors()
+	ok := true
+	intercept(outbound, dispatcherPacket, func(dispatcherPacket interface{}) {
+		if ok {
+			ok = c.writeEncoded(conn, codec, dispatcherPacket, logger)
+		}
+	})
+	return ok
+}
+
+func (c *Client) writeEncoded(conn *websocket.Conn, codec Codec, dispatcherPacket interface{}, logger Logger) bool {
+	packet, err := codec.Encode(dispatcherPacket)
+	if err != nil {
+		logger.Warn("cannot encode packet", Fields{"error": err})
+		return true
+	}
+	c.setWriteDeadline(conn)
+	if err := conn.WriteMessage(codec.MessageType(), packet); err != nil {
+		logger.Warn("write failed", Fields{"error": err})
+		conn.Close()
+		return false
+	}
+	return true
 }
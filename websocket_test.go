@@ -0,0 +1,210 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde/shared"
+	"github.com/gorilla/websocket"
+)
+
+// fakeRotonde is a websocket server recording the packets it receives.
+type fakeRotonde struct {
+	server *httptest.Server
+
+	mutex    *sync.Mutex
+	received []interface{}
+	conns    []*websocket.Conn
+	// silent stops the answers to pings
+	silent bool
+}
+
+func newFakeRotonde(t testing.TB) *fakeRotonde {
+	f := &fakeRotonde{mutex: &sync.Mutex{}}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.SetPingHandler(func(data string) error {
+			f.mutex.Lock()
+			silent := f.silent
+			f.mutex.Unlock()
+			if silent {
+				return nil
+			}
+			conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+			return nil
+		})
+		f.mutex.Lock()
+		f.conns = append(f.conns, conn)
+		f.mutex.Unlock()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			packet, err := JSONCodec.Decode(data)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			f.mutex.Lock()
+			f.received = append(f.received, packet)
+			f.mutex.Unlock()
+		}
+	}))
+	return f
+}
+
+func (f *fakeRotonde) url() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+// write sends a frame on the latest connection.
+func (f *fakeRotonde) write(data []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.conns) == 0 {
+		return errors.New("not connected")
+	}
+	return f.conns[len(f.conns)-1].WriteMessage(websocket.TextMessage, data)
+}
+
+func (f *fakeRotonde) packets() []interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]interface{}(nil), f.received...)
+}
+
+func (f *fakeRotonde) close() {
+	f.mutex.Lock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.mutex.Unlock()
+	f.server.Close()
+}
+
+func waitState(t testing.TB, c *Client, state State) {
+	deadline := time.Now().Add(2 * time.Second)
+	for c.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("client is %v, expected %v", c.State(), state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueuedPacketsAreNotReplayedTwice(t *testing.T) {
+	f := newFakeRotonde(t)
+	defer f.close()
+
+	c := NewClient(f.url(), WithLogger(NopLogger()))
+	defer c.Close()
+	c.AddLocalDefinition(&rotonde.Definition{"temp", "event", false, nil})
+	c.subscribe("light")
+	waitState(t, c, Connected)
+	time.Sleep(50 * time.Millisecond)
+
+	definitions, subscriptions := 0, 0
+	for _, packet := range f.packets() {
+		switch packet.(type) {
+		case rotonde.Definition:
+			definitions++
+		case rotonde.Subscription:
+			subscriptions++
+		}
+	}
+	if definitions != 1 || subscriptions != 1 {
+		t.Fatalf("received %v definitions and %v subscriptions", definitions, subscriptions)
+	}
+}
+
+func TestCloseFlushesQueuedPackets(t *testing.T) {
+	f := newFakeRotonde(t)
+	defer f.close()
+
+	c := NewClient(f.url(), WithLogger(NopLogger()))
+	c.AddLocalDefinition(&rotonde.Definition{"temp", "event", false, nil})
+	waitState(t, c, Connected)
+	c.RemoveLocalDefinition("event", "temp")
+	c.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	for _, packet := range f.packets() {
+		if _, ok := packet.(rotonde.UnDefinition); ok {
+			return
+		}
+	}
+	t.Fatalf("undefinition not written before closing, received %v", f.packets())
+}
+
+func TestCloseAbortsHandshake(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	c := NewClient("ws://"+listener.Addr().String(), WithLogger(NopLogger()))
+	// accept the connection but never answer the handshake
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Fatal("handshake still in progress after Close: ", err)
+	}
+}
+
+// recordingLogger keeps the fields of the Info messages.
+type recordingLogger struct {
+	nopLogger
+	mutex *sync.Mutex
+	infos map[string]Fields
+}
+
+func (l recordingLogger) Info(msg string, fields Fields) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.infos[msg] = fields
+}
+
+func (l recordingLogger) info(msg string) Fields {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.infos[msg]
+}
+
+func TestConnectionLogsActiveEndpoint(t *testing.T) {
+	f := newFakeRotonde(t)
+	defer f.close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := "ws://" + listener.Addr().String()
+	listener.Close()
+
+	logger := recordingLogger{mutex: &sync.Mutex{}, infos: make(map[string]Fields)}
+	c := NewClient(primary, WithEndpoints(f.url()), WithLogger(logger))
+	defer c.Close()
+	waitState(t, c, Connected)
+
+	if endpoint := logger.info("connected")["endpoint"]; endpoint != f.url() {
+		t.Fatalf("connected to %v, expected %v", endpoint, f.url())
+	}
+}